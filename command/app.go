@@ -4,11 +4,19 @@ import (
 	"context"
 	"os"
 
+	c "rafal.dev/reflow/pkg/context"
 	"rafal.dev/reflow/pkg/debug"
+	f "rafal.dev/reflow/pkg/fmt"
+	"rafal.dev/reflow/pkg/reflow"
+	"rafal.dev/reflow/pkg/template"
 )
 
 type App struct {
 	ctx context.Context
+
+	// Template options the commands execute templates with, configured
+	// by the persistent flags.
+	Template template.Options
 }
 
 func NewApp(ctx context.Context) *App {
@@ -17,7 +25,8 @@ func NewApp(ctx context.Context) *App {
 	}
 
 	app := &App{
-		ctx: ctx,
+		ctx:      ctx,
+		Template: template.Default,
 	}
 
 	return app
@@ -26,3 +35,29 @@ func NewApp(ctx context.Context) *App {
 func (app *App) Context() context.Context {
 	return app.ctx
 }
+
+// Builder returns the default context builder, which executes templates
+// with the options of the app.
+func (app *App) Builder() c.Builder {
+	return c.NewDefaultBuilder(&app.Template)
+}
+
+// Formater returns the default formater, which builds the context with
+// the Builder and executes templates with the options of the app.
+func (app *App) Formater() *f.Formater {
+	fm := *f.DefaultFormater
+	fm.Builder = app.Builder()
+	fm.Template = &app.Template
+
+	return &fm
+}
+
+// Client returns the default reflow client, which executes templates
+// with the options of the app.
+func (app *App) Client() *reflow.Client {
+	cl := reflow.New()
+	cl.Fmt = app.Formater()
+	cl.Template = &app.Template
+
+	return cl
+}
@@ -0,0 +1,308 @@
+package context
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"rafal.dev/reflow/command"
+	"rafal.dev/reflow/pkg/codec"
+	c "rafal.dev/reflow/pkg/context"
+	f "rafal.dev/reflow/pkg/fmt"
+	"rafal.dev/reflow/pkg/jq"
+	"rafal.dev/reflow/pkg/keypath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+func NewCommand(app *command.App) *cobra.Command {
+	m := &contextCmd{
+		App:      app,
+		Formater: app.Formater(),
+	}
+
+	dump := &cobra.Command{
+		Use:   "dump",
+		Short: "Prints the built context",
+		Args:  cobra.NoArgs,
+		RunE:  m.dump,
+	}
+
+	dump.Flags().BoolVarP(&m.mask, "mask", "m", false, "Mask keys listed under the mask key")
+
+	get := &cobra.Command{
+		Use:   "get <path>",
+		Short: "Prints the value under the path, a JSONPath query or a jq expression",
+		Args:  cobra.ExactArgs(1),
+		RunE:  m.get,
+	}
+
+	get.Flags().BoolVarP(&m.jq, "jq", "q", false, "Evaluate the argument as a jq expression")
+
+	set := &cobra.Command{
+		Use:   "set <path> <value>",
+		Short: "Sets the value under the path in the given layer file",
+		Args:  cobra.ExactArgs(2),
+		RunE:  m.set,
+	}
+
+	set.Flags().StringVarP(&m.file, "file", "f", "", "Layer file to update")
+	set.MarkFlagRequired("file")
+
+	cmd := &cobra.Command{
+		Use:   "context",
+		Short: "Inspects the built context",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(
+		dump,
+		get,
+		set,
+		&cobra.Command{
+			Use:   "explain <path>",
+			Short: "Explains where the value under the path came from",
+			Args:  cobra.ExactArgs(1),
+			RunE:  m.explain,
+		},
+	)
+
+	m.register(cmd.PersistentFlags())
+
+	return cmd
+}
+
+type contextCmd struct {
+	*command.App
+	*f.Formater
+	run    string
+	format string
+	mask   bool
+	file   string
+	jq     bool
+}
+
+func (m *contextCmd) register(f *pflag.FlagSet) {
+	f.StringVarP(&m.run, "run", "r", "", "Build the context of the given run ID")
+	f.StringVarP(&m.format, "format", "o", "yaml", "Output format: json, yaml or env")
+}
+
+func (m *contextCmd) builder() (c.Builder, error) {
+	if m.run != "" {
+		return m.Client().Builder(m.run)
+	}
+
+	return m.App.Builder(), nil
+}
+
+func (m *contextCmd) build(ctx context.Context) (map[string]any, error) {
+	obj := make(map[string]any)
+
+	b, err := m.builder()
+	if err != nil {
+		return nil, fmt.Errorf("build error: %w", err)
+	}
+
+	if err := b.Build(ctx, obj); err != nil {
+		return nil, fmt.Errorf("build error: %w", err)
+	}
+
+	return obj, nil
+}
+
+func (m *contextCmd) dump(*cobra.Command, []string) error {
+	obj, err := m.build(m.Context())
+	if err != nil {
+		return err
+	}
+
+	if m.mask {
+		if err := c.Mask(obj); err != nil {
+			return err
+		}
+	}
+
+	return m.print(obj)
+}
+
+func (m *contextCmd) get(_ *cobra.Command, args []string) error {
+	obj, err := m.build(m.Context())
+	if err != nil {
+		return err
+	}
+
+	var v any
+
+	switch {
+	case m.jq:
+		q, err := jq.ParseEnv(args[0])
+		if err != nil {
+			return err
+		}
+
+		out, err := q.Run(m.Context(), obj)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range out {
+			if err := m.print(v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case strings.HasPrefix(args[0], "$"):
+		v, err = keypath.Query(obj, args[0])
+	default:
+		v, err = c.Get[any](obj, args[0])
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch v.(type) {
+	case map[string]any, []any:
+		return m.print(v)
+	default:
+		fmt.Println(v)
+	}
+
+	return nil
+}
+
+func (m *contextCmd) set(_ *cobra.Command, args []string) error {
+	var v any
+
+	if err := yaml.Unmarshal([]byte(args[1]), &v); err != nil {
+		return fmt.Errorf("parse value: %w", err)
+	}
+
+	var (
+		base = filepath.Base(m.file)
+		key  = strings.TrimSuffix(base, filepath.Ext(base))
+	)
+
+	p, err := keypath.Parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(p) < 2 || p[0].Kind != keypath.Key || p[0].Key != key {
+		return fmt.Errorf("path %q does not belong to layer %q", args[0], key)
+	}
+
+	doc, err := m.Formater.ReadFile(m.file)
+	if errors.Is(err, os.ErrNotExist) {
+		doc, err = nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("read layer: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(m.file)); ext {
+	case ".yaml", ".yml":
+		// Layers are edited as YAML documents, so their comments
+		// and tags are kept.
+		if doc, err = c.SetYAML(doc, p[1:], v); err != nil {
+			return fmt.Errorf("layer %q: %w", m.file, err)
+		}
+	default:
+		obj := make(map[string]any)
+
+		if len(doc) != 0 {
+			if err := codec.Unmarshal(doc, ext, &obj); err != nil {
+				return fmt.Errorf("unmarshal layer: %w", err)
+			}
+		}
+
+		if p[1:].Wildcard() {
+			return fmt.Errorf("set %q: wildcards are not supported", args[0])
+		}
+
+		if _, _, err := keypath.Set(obj, p[1:], v); err != nil {
+			return fmt.Errorf("set %q: %w", args[0], err)
+		}
+
+		if doc, err = m.Formater.Encode(obj, ext); err != nil {
+			return fmt.Errorf("marshal layer: %w", err)
+		}
+	}
+
+	if err := m.Formater.WriteFile(m.file, doc); err != nil {
+		return fmt.Errorf("write layer: %w", err)
+	}
+
+	return nil
+}
+
+func (m *contextCmd) print(v any) error {
+	p, err := m.Formater.Encode(v, m.format)
+	if err != nil {
+		return fmt.Errorf("encode error: %w", err)
+	}
+
+	os.Stdout.Write(p)
+
+	if len(p) != 0 && p[len(p)-1] != '\n' {
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func (m *contextCmd) explain(_ *cobra.Command, args []string) error {
+	p, err := keypath.Parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	var (
+		path = p.String()
+		prov = c.NewProvenance()
+	)
+
+	obj, err := m.build(c.WithProvenance(m.Context(), prov))
+	if err != nil {
+		return err
+	}
+
+	paths := prov.Paths(path)
+	if len(paths) == 0 {
+		return fmt.Errorf("no recorded origin for %q", path)
+	}
+
+	for _, path := range paths {
+		origins := prov.Origins(path)
+
+		if v, err := c.Get[any](obj, path); err == nil {
+			fmt.Printf("%s = %s\n", path, encode(v))
+		} else {
+			fmt.Printf("%s (deleted)\n", path)
+		}
+
+		fmt.Printf("  source: %s\n", origins[len(origins)-1])
+
+		for i := len(origins) - 2; i >= 0; i-- {
+			fmt.Printf("  overrides: %s\n", origins[i])
+		}
+	}
+
+	return nil
+}
+
+func encode(v any) string {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(p)
+}
@@ -11,7 +11,7 @@ import (
 func NewCommand(app *command.App) *cobra.Command {
 	m := &fmtCmd{
 		App:      app,
-		Formater: f.DefaultFormater,
+		Formater: app.Formater(),
 	}
 
 	cmd := &cobra.Command{
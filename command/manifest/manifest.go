@@ -12,8 +12,12 @@ import (
 
 func NewCommand(app *command.App) *cobra.Command {
 	m := &manifestCmd{
-		App:     app,
-		Builder: manifest.DefaultBuilder,
+		App: app,
+		Builder: &manifest.Builder{
+			Home:    manifest.DefaultBuilder.Home,
+			Context: app.Builder(),
+			Fmt:     app.Formater(),
+		},
 	}
 
 	cmd := &cobra.Command{
@@ -1,10 +1,16 @@
 package reflow
 
 import (
+	"io/fs"
+	"path/filepath"
+
 	"rafal.dev/reflow/command"
+	"rafal.dev/reflow/command/context"
 	"rafal.dev/reflow/command/fmt"
 	"rafal.dev/reflow/command/manifest"
+	"rafal.dev/reflow/command/secrets"
 	"rafal.dev/reflow/command/template"
+	"rafal.dev/reflow/internal/misc"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -13,6 +19,8 @@ import (
 func NewCommand(app *command.App) *cobra.Command {
 	m := &reflowCmd{App: app}
 
+	app.Template.Partials = []fs.FS{misc.HomeDir(filepath.Join("templates", "_partials"))}
+
 	cmd := &cobra.Command{
 		Use:   "reflow",
 		Short: "Formatting",
@@ -21,13 +29,16 @@ func NewCommand(app *command.App) *cobra.Command {
 	}
 
 	cmd.AddCommand(
+		context.NewCommand(app),
 		fmt.NewCommand(app),
 		manifest.NewCommand(app),
+		secrets.NewCommand(app),
 		template.NewCommand(app),
 		NewRunCommand(app),
+		NewValidateCommand(app),
 	)
 
-	m.register(cmd.Flags())
+	m.register(cmd.PersistentFlags())
 
 	return cmd
 }
@@ -37,6 +48,7 @@ type reflowCmd struct {
 }
 
 func (m *reflowCmd) register(f *pflag.FlagSet) {
+	f.BoolVar(&m.App.Template.Strict, "strict", m.App.Template.Strict, "Fail on templates referencing missing keys")
 }
 
 func (*reflowCmd) run(*cobra.Command, []string) error {
@@ -10,7 +10,7 @@ import (
 func NewRunCommand(app *command.App) *cobra.Command {
 	m := &runCmd{
 		App:    app,
-		Client: reflow.New(),
+		Client: app.Client(),
 	}
 
 	cmd := &cobra.Command{
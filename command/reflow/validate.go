@@ -0,0 +1,70 @@
+package reflow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"rafal.dev/reflow/command"
+	c "rafal.dev/reflow/pkg/context"
+
+	"github.com/spf13/cobra"
+)
+
+func NewValidateCommand(app *command.App) *cobra.Command {
+	m := &validateCmd{App: app}
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validates the built context against schemas",
+		Args:  cobra.NoArgs,
+		RunE:  m.run,
+	}
+
+	m.register(cmd)
+
+	return cmd
+}
+
+type validateCmd struct {
+	*command.App
+	runID string
+}
+
+func (m *validateCmd) register(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVarP(&m.runID, "run", "r", "", "Validate the context of the given run ID")
+}
+
+func (m *validateCmd) builder() (c.Builder, error) {
+	if m.runID != "" {
+		return m.Client().Builder(m.runID)
+	}
+
+	return m.App.Builder(), nil
+}
+
+func (m *validateCmd) run(*cobra.Command, []string) error {
+	var (
+		ctx  = c.WithProvenance(m.App.Context(), c.NewProvenance())
+		obj  = make(map[string]any)
+		verr *c.ValidationError
+	)
+
+	b, err := m.builder()
+	if err != nil {
+		return err
+	}
+
+	err = b.Build(ctx, obj)
+	if errors.As(err, &verr) {
+		for _, v := range verr.Violations {
+			fmt.Fprintln(os.Stderr, v)
+		}
+
+		return fmt.Errorf("found %d schema violations", len(verr.Violations))
+	}
+
+	return err
+}
@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"rafal.dev/reflow/command"
+	"rafal.dev/reflow/pkg/secret"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommand(app *command.App) *cobra.Command {
+	m := &secretsCmd{
+		App:   app,
+		store: secret.DefaultStore,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manages encrypted secrets",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "set <name> [value]",
+			Short: "Encrypts and stores a secret, reads value from stdin if not given",
+			Args:  cobra.RangeArgs(1, 2),
+			RunE:  m.set,
+		},
+		&cobra.Command{
+			Use:   "get <name>",
+			Short: "Decrypts and prints a secret",
+			Args:  cobra.ExactArgs(1),
+			RunE:  m.get,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "Lists stored secrets",
+			Args:  cobra.NoArgs,
+			RunE:  m.list,
+		},
+		&cobra.Command{
+			Use:   "keygen",
+			Short: "Generates a new encryption key",
+			Args:  cobra.NoArgs,
+			RunE:  m.keygen,
+		},
+	)
+
+	return cmd
+}
+
+type secretsCmd struct {
+	*command.App
+	store func() (*secret.Store, error)
+}
+
+func (m *secretsCmd) set(_ *cobra.Command, args []string) error {
+	s, err := m.store()
+	if err != nil {
+		return err
+	}
+
+	var value []byte
+
+	if len(args) == 2 {
+		value = []byte(args[1])
+	} else {
+		p, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read error: %w", err)
+		}
+
+		value = p
+	}
+
+	return s.Set(args[0], value)
+}
+
+func (m *secretsCmd) get(_ *cobra.Command, args []string) error {
+	s, err := m.store()
+	if err != nil {
+		return err
+	}
+
+	p, err := s.Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(p)
+
+	return nil
+}
+
+func (m *secretsCmd) list(*cobra.Command, []string) error {
+	s, err := m.store()
+	if err != nil {
+		return err
+	}
+
+	names, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+
+	return nil
+}
+
+func (*secretsCmd) keygen(*cobra.Command, []string) error {
+	k, err := secret.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(k)
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"rafal.dev/reflow/command"
+	"rafal.dev/reflow/internal/misc"
+	"rafal.dev/reflow/pkg/codec"
+	c "rafal.dev/reflow/pkg/context"
+	"rafal.dev/reflow/pkg/secret"
+
+	"github.com/spf13/cobra"
+)
+
+func newLintCommand(app *command.App) *cobra.Command {
+	m := &lintCmd{App: app}
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Checks templates for syntax errors, missing keys and deprecated funcs",
+		Args:  cobra.NoArgs,
+		RunE:  m.run,
+		// Problems found are not usage errors.
+		SilenceUsage: true,
+	}
+
+	m.register(cmd)
+
+	return cmd
+}
+
+type lintCmd struct {
+	*command.App
+	runID  string
+	sample string
+}
+
+func (m *lintCmd) register(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVarP(&m.runID, "run", "r", "", "Lint the templates of the given run ID")
+	f.StringVarP(&m.sample, "context", "c", "", "Check references against the sample context file instead of the built one")
+}
+
+func (m *lintCmd) run(cmd *cobra.Command, _ []string) error {
+	obj, err := m.context()
+	if err != nil {
+		return err
+	}
+
+	key, err := secret.DefaultKey()
+	if err != nil {
+		return err
+	}
+
+	type dir struct {
+		path      string
+		recursive bool
+		partials  bool
+		run       bool
+	}
+
+	var (
+		home = misc.Home()
+		opts = m.App.Template
+		dirs = []dir{
+			{"context", true, false, false},
+			{"templates", false, false, false},
+			{filepath.Join("templates", "_partials"), true, true, false},
+		}
+		runOpts = opts
+		seen    = make(map[string]bool)
+		n       int
+	)
+
+	// Templates of the run are executed in the restricted mode,
+	// with partials of the run available to them only.
+	if m.runID != "" {
+		run := filepath.Join("runs", m.runID, "templates")
+
+		runOpts.Restricted = true
+		runOpts.Partials = append(opts.Partials[:len(opts.Partials):len(opts.Partials)], os.DirFS(filepath.Join(home, run, "_partials")))
+
+		dirs = append(dirs, dir{run, false, false, true}, dir{filepath.Join(run, "_partials"), true, true, true})
+	}
+
+	for _, d := range dirs {
+		root := filepath.Join(home, d.path)
+
+		files, err := listFiles(root, d.recursive)
+		if err != nil {
+			return fmt.Errorf("listing %q: %w", d.path, err)
+		}
+
+		for _, file := range files {
+			p, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			if p, err = key.Open(p); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+
+			// Partials are named the same way they are when loaded,
+			// so their problems are reported once.
+			o, s := opts, string(p)
+			if d.run {
+				o = runOpts
+			}
+			o.Name, _ = filepath.Rel(home, file)
+
+			if d.partials {
+				rel, _ := filepath.Rel(root, file)
+				o.Name = path.Join("_partials", filepath.ToSlash(rel))
+			}
+
+			if o, s, err = o.File(o.Name, s); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+
+			for _, p := range o.Lint(s, obj) {
+				if s := p.String(); !seen[s] {
+					seen[s] = true
+					n++
+
+					fmt.Fprintln(cmd.OutOrStdout(), s)
+				}
+			}
+		}
+	}
+
+	if n != 0 {
+		return fmt.Errorf("found %d problems", n)
+	}
+
+	return nil
+}
+
+// context reads the sample context or builds one without executing
+// the templates, commands or requests configured in it.
+func (m *lintCmd) context() (map[string]any, error) {
+	obj := make(map[string]any)
+
+	if m.sample != "" {
+		p, err := os.ReadFile(m.sample)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := codec.Unmarshal(p, filepath.Ext(m.sample), &obj); err != nil {
+			return nil, fmt.Errorf("reading %q: %w", m.sample, err)
+		}
+
+		return obj, nil
+	}
+
+	var (
+		b    c.Builder = m.App.Builder()
+		verr *c.ValidationError
+	)
+
+	if m.runID != "" {
+		rb, err := m.Client().Builder(m.runID)
+		if err != nil {
+			return nil, fmt.Errorf("build error: %w", err)
+		}
+
+		b = rb
+	}
+
+	if err := b.Build(c.WithoutConv(m.Context()), obj); err != nil && !errors.As(err, &verr) {
+		return nil, fmt.Errorf("build error: %w", err)
+	}
+
+	return obj, nil
+}
+
+func listFiles(dir string, recursive bool) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir() && file != dir && !recursive:
+			return filepath.SkipDir
+		case !d.IsDir():
+			files = append(files, file)
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return files, err
+}
@@ -0,0 +1,68 @@
+package template
+
+import (
+	"fmt"
+
+	"rafal.dev/reflow/command"
+	f "rafal.dev/reflow/pkg/fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newRenderCommand(app *command.App) *cobra.Command {
+	m := &renderCmd{
+		App:      app,
+		Formater: app.Formater(),
+	}
+
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Renders a directory of templates",
+		Args:  cobra.NoArgs,
+		RunE:  m.run,
+	}
+
+	m.register(cmd)
+
+	return cmd
+}
+
+type renderCmd struct {
+	*command.App
+	*f.Formater
+	src string
+	out string
+}
+
+func (m *renderCmd) register(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVar(&m.src, "src", "", "Directory of the templates")
+	f.StringVar(&m.out, "out", "", "Directory to write the rendered files to")
+
+	cmd.MarkFlagRequired("src")
+	cmd.MarkFlagRequired("out")
+}
+
+func (m *renderCmd) run(*cobra.Command, []string) error {
+	rendered, err := m.Formater.Render(m.Context(), m.src, m.out)
+
+	var skipped int
+
+	for _, r := range rendered {
+		if r.Skipped {
+			skipped++
+			fmt.Printf("skipped  %s\n", r.Src)
+		} else {
+			fmt.Printf("rendered %s -> %s\n", r.Src, r.Out)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d rendered, %d skipped\n", len(rendered)-skipped, skipped)
+
+	return nil
+}
@@ -7,7 +7,6 @@ import (
 
 	"rafal.dev/reflow/command"
 	c "rafal.dev/reflow/pkg/context"
-	"rafal.dev/reflow/pkg/template"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -25,6 +24,8 @@ func NewCommand(app *command.App) *cobra.Command {
 		RunE:  m.run,
 	}
 
+	cmd.AddCommand(newLintCommand(app), newRenderCommand(app))
+
 	m.register(cmd.Flags())
 
 	return cmd
@@ -33,26 +34,26 @@ func NewCommand(app *command.App) *cobra.Command {
 type templateCmd struct {
 	*command.App
 	exclude bool
+	delims  []string
+	keep    bool
 }
 
 func (m *templateCmd) register(f *pflag.FlagSet) {
 	f.BoolVarP(&m.exclude, "exclude", "e", false, "List of keys to exclude")
+	f.StringSliceVar(&m.delims, "delims", nil, "Left and right action delimiters, e.g. [[,]]")
+	f.BoolVar(&m.keep, "keep-expressions", false, "Leave GitHub expressions, like ${{ github.sha }}, untouched")
 }
 
 func (m *templateCmd) run(_ *cobra.Command, args []string) error {
-	obj, err := c.Build(m.Context())
-	if err != nil {
+	obj := make(map[string]any)
+
+	if err := m.App.Builder().Build(m.Context(), obj); err != nil {
 		return fmt.Errorf("build error: %w", err)
 	}
 
 	if m.exclude {
-		v, err := c.Get[[]any](obj, "exclude")
-		if err != nil {
-			return fmt.Errorf("excluding keys: %w", err)
-		}
-
-		for _, v := range v {
-			c.Del(obj, fmt.Sprint(v))
+		if err := c.Exclude(obj); err != nil {
+			return err
 		}
 	}
 
@@ -61,7 +62,25 @@ func (m *templateCmd) run(_ *cobra.Command, args []string) error {
 		return fmt.Errorf("read error: %w", err)
 	}
 
-	q, err := template.Execute(string(p), obj)
+	o := m.App.Template
+	o.Name = "<stdin>"
+	o.Context = m.Context()
+	o.KeepExpressions = m.keep
+
+	if len(m.delims) != 0 {
+		if len(m.delims) != 2 {
+			return fmt.Errorf("want left and right delims, got %q", m.delims)
+		}
+
+		o.Delims = [2]string{m.delims[0], m.delims[1]}
+	}
+
+	o, s, err := o.File("", string(p))
+	if err != nil {
+		return fmt.Errorf("execute template error: %w", err)
+	}
+
+	q, err := o.Execute(s, obj)
 	if err != nil {
 		return fmt.Errorf("execute template error: %w", err)
 	}
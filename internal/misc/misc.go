@@ -84,6 +84,8 @@ func initHome(dir string) error {
 		os.MkdirAll(filepath.Join(dir, "context"), 0755),
 		os.MkdirAll(filepath.Join(dir, "templates"), 0755),
 		os.MkdirAll(filepath.Join(dir, "outputs"), 0755),
+		os.MkdirAll(filepath.Join(dir, "schemas"), 0755),
+		os.MkdirAll(filepath.Join(dir, "secrets"), 0700),
 	)
 }
 
@@ -0,0 +1,457 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/printer"
+	"github.com/hashicorp/hcl/hcl/token"
+	hjson "github.com/hashicorp/hcl/json/parser"
+	"github.com/magiconair/properties"
+	"gopkg.in/yaml.v3"
+)
+
+// Codec marshals and unmarshals values of a single format.
+type Codec struct {
+	Marshal   func(v any) ([]byte, error)
+	Unmarshal func(p []byte, v any) error
+}
+
+var (
+	mu      sync.RWMutex
+	formats = make(map[string]*Codec)
+)
+
+func init() {
+	Register(&Codec{Marshal: json.Marshal, Unmarshal: yaml.Unmarshal}, "json")
+	Register(&Codec{Marshal: yaml.Marshal, Unmarshal: yaml.Unmarshal}, "yaml", "yml")
+	Register(&Codec{Marshal: marshalJSON5, Unmarshal: unmarshalJSON5}, "json5", "jsonc")
+	Register(&Codec{Marshal: marshalTOML, Unmarshal: unmarshalTOML}, "toml")
+	Register(&Codec{Marshal: marshalEnv, Unmarshal: unmarshalEnv}, "env", "dotenv")
+	Register(&Codec{Marshal: marshalHCL, Unmarshal: unmarshalHCL}, "hcl")
+	Register(&Codec{Marshal: marshalProperties, Unmarshal: unmarshalProperties}, "properties")
+}
+
+// Register makes the codec available under the given formats, which
+// are file extensions with or without the leading dot.
+func Register(c *Codec, format ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, f := range format {
+		formats[normalize(f)] = c
+	}
+}
+
+func Lookup(format string) (*Codec, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c, ok := formats[normalize(format)]
+	return c, ok
+}
+
+// Formats returns sorted names of all registered formats.
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var s []string
+
+	for f := range formats {
+		s = append(s, f)
+	}
+
+	sort.Strings(s)
+
+	return s
+}
+
+func Marshal(v any, format string) ([]byte, error) {
+	c, ok := Lookup(format)
+	if !ok {
+		return nil, fmt.Errorf("unsupported format: %q", normalize(format))
+	}
+
+	return c.Marshal(v)
+}
+
+func Unmarshal(p []byte, format string, v any) error {
+	c, ok := Lookup(format)
+	if !ok {
+		return fmt.Errorf("unsupported format: %q", normalize(format))
+	}
+
+	return c.Unmarshal(p, v)
+}
+
+func normalize(format string) string {
+	return strings.ToLower(strings.TrimPrefix(format, "."))
+}
+
+// assign stores the decoded generic value src in dst, which is
+// a pointer to any or to a concrete type decodable from YAML.
+func assign(src, dst any) error {
+	switch dst := dst.(type) {
+	case *any:
+		*dst = src
+		return nil
+	case *map[string]any:
+		if m, ok := src.(map[string]any); ok {
+			*dst = m
+			return nil
+		}
+	}
+
+	p, err := yaml.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(p, dst)
+}
+
+// Generic converts v in place to the types yaml.v3 decodes values to,
+// so values coming from any source merge and compare alike, e.g. int64
+// and json.Number to int. Values of other types, like structs returned
+// by API clients, are converted by their JSON encoding.
+func Generic(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, string, bool, int, float64, time.Time:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n), nil
+		}
+
+		return v.Float64()
+	case map[string]any:
+		for k, w := range v {
+			w, err := Generic(w)
+			if err != nil {
+				return nil, err
+			}
+
+			v[k] = w
+		}
+
+		return v, nil
+	case []any:
+		for i, w := range v {
+			w, err := Generic(w)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = w
+		}
+
+		return v, nil
+	case []map[string]any:
+		l := make([]any, len(v))
+
+		for i, w := range v {
+			w, err := Generic(w)
+			if err != nil {
+				return nil, err
+			}
+
+			l[i] = w
+		}
+
+		return l, nil
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Struct, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Array:
+		p, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var w any
+
+		if err := yaml.Unmarshal(p, &w); err != nil {
+			return nil, err
+		}
+
+		return w, nil
+	default:
+		return v, nil
+	}
+}
+
+func marshalTOML(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+
+	if err := toml.NewEncoder(&buf).Encode(dropNil(v)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// dropNil returns a copy of v without the nil values of its maps and lists.
+func dropNil(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+
+		for k, w := range v {
+			if w != nil {
+				m[k] = dropNil(w)
+			}
+		}
+
+		return m
+	case []any:
+		l := make([]any, 0, len(v))
+
+		for _, w := range v {
+			if w != nil {
+				l = append(l, dropNil(w))
+			}
+		}
+
+		return l
+	default:
+		return v
+	}
+}
+
+func unmarshalTOML(p []byte, v any) error {
+	var m map[string]any
+
+	if err := toml.Unmarshal(p, &m); err != nil {
+		return err
+	}
+
+	w, err := Generic(m)
+	if err != nil {
+		return err
+	}
+
+	return assign(w, v)
+}
+
+func marshalHCL(v any) ([]byte, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := hjson.Parse(p)
+	if err != nil {
+		return nil, err
+	}
+
+	ast.Walk(f, func(n ast.Node) (ast.Node, bool) {
+		if item, ok := n.(*ast.ObjectItem); ok {
+			for _, k := range item.Keys {
+				if s, err := strconv.Unquote(k.Token.Text); err == nil && isIdentKey(s) {
+					k.Token.Type, k.Token.Text = token.IDENT, s
+				}
+			}
+
+			if _, ok := item.Val.(*ast.ObjectType); ok {
+				item.Assign = token.Pos{}
+			}
+		}
+
+		return n, true
+	})
+
+	var buf bytes.Buffer
+
+	if err := printer.Fprint(&buf, f); err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func unmarshalHCL(p []byte, v any) error {
+	var m map[string]any
+
+	if err := hcl.Unmarshal(p, &m); err != nil {
+		return err
+	}
+
+	w, err := Generic(blocks(m))
+	if err != nil {
+		return err
+	}
+
+	return assign(w, v)
+}
+
+func isIdentKey(s string) bool {
+	for i, r := range s {
+		if !isIdent(r) && (i == 0 || r != '-') {
+			return false
+		}
+	}
+
+	return s != "" && !unicode.IsDigit(rune(s[0]))
+}
+
+// blocks collapses the lists HCL decodes blocks into, so that
+// `a { b = 1 }` reads as a.b rather than a[0].b.
+func blocks(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, w := range v {
+			v[k] = blocks(w)
+		}
+		return v
+	case []map[string]any:
+		m := make(map[string]any)
+
+		for _, w := range v {
+			for k, w := range w {
+				m[k] = blocks(w)
+			}
+		}
+
+		return m
+	case []any:
+		for i, w := range v {
+			v[i] = blocks(w)
+		}
+	}
+
+	return v
+}
+
+func marshalProperties(v any) ([]byte, error) {
+	flat := make(map[string]string)
+
+	if err := flatten(v, "", ".", flat); err != nil {
+		return nil, err
+	}
+
+	var (
+		keys = make([]string, 0, len(flat))
+		prop = properties.NewProperties()
+		buf  bytes.Buffer
+	)
+
+	for k := range flat {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if _, _, err := prop.Set(k, flat[k]); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := prop.Write(&buf, properties.UTF8); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func unmarshalProperties(p []byte, v any) error {
+	prop, err := (&properties.Loader{Encoding: properties.UTF8, DisableExpansion: true}).LoadBytes(p)
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]any)
+
+	for _, k := range prop.Keys() {
+		if err := unflatten(m, strings.Split(k, "."), prop.GetString(k, "")); err != nil {
+			return fmt.Errorf("key %q: %w", k, err)
+		}
+	}
+
+	return assign(m, v)
+}
+
+func flatten(v any, prefix, sep string, out map[string]string) error {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + sep + k
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, w := range v {
+			if err := flatten(w, join(k), sep, out); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, w := range v {
+			if err := flatten(w, join(strconv.Itoa(i)), sep, out); err != nil {
+				return err
+			}
+		}
+	case nil:
+		if prefix != "" {
+			out[prefix] = ""
+		}
+	default:
+		if prefix == "" {
+			return fmt.Errorf("cannot marshal non-object value %T", v)
+		}
+
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice {
+			return fmt.Errorf("%s: unsupported type %T", prefix, v)
+		}
+
+		out[prefix] = fmt.Sprint(v)
+	}
+
+	return nil
+}
+
+func unflatten(m map[string]any, keys []string, v string) error {
+	for i, k := range keys[:len(keys)-1] {
+		switch w := m[k].(type) {
+		case nil:
+			n := make(map[string]any)
+			m[k] = n
+			m = n
+		case map[string]any:
+			m = w
+		default:
+			return fmt.Errorf("%s is not an object", strings.Join(keys[:i+1], "."))
+		}
+	}
+
+	k := keys[len(keys)-1]
+
+	if _, ok := m[k].(map[string]any); ok {
+		return fmt.Errorf("%s is an object", strings.Join(keys, "."))
+	}
+
+	m[k] = v
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnmarshal(t *testing.T) {
+	want := map[string]any{
+		"image": map[string]any{
+			"repo": "reflow",
+			"tag":  "v1.0.0",
+		},
+		"replicas": 3,
+	}
+
+	cases := []struct {
+		format string
+		in     string
+		want   map[string]any
+	}{
+		0: {"toml", "replicas = 3\n[image]\nrepo = \"reflow\"\ntag = 'v1.0.0'\n", want},
+		1: {"hcl", "replicas = 3\nimage {\n  repo = \"reflow\"\n  tag = \"v1.0.0\"\n}\n", want},
+		2: {"json5", `{
+			// comment
+			image: {repo: 'reflow', "tag": "v1.0.0",},
+			/* block */ replicas: +0x3,
+		}`, want},
+		3: {"jsonc", "{\"image\": {\"repo\": \"reflow\", \"tag\": \"v1.0.0\"}, // x\n\"replicas\": 3,}", want},
+		4: {"env", "# comment\nIMAGE_TAG=\"v1.0.0\"\nexport REPLICAS=3\n", map[string]any{"IMAGE_TAG": "v1.0.0", "REPLICAS": "3"}},
+		5: {"env", "A='it'\\''s' # comment\nB=\"$A \\$A\\n\"'x\ny'\nexport C = ${B}c d \nD='#'", map[string]any{
+			"A": "it's",
+			"B": "it's $A\nx\ny",
+			"C": "it's $A\nx\nyc d",
+			"D": "#",
+		}},
+		6: {"properties", "image.repo = reflow\nimage.tag: v1.0.0\nreplicas=3\n", map[string]any{
+			"image":    map[string]any{"repo": "reflow", "tag": "v1.0.0"},
+			"replicas": "3",
+		}},
+		7: {"properties", "a=${a}\nb=${a}-${missing}\n", map[string]any{"a": "${a}", "b": "${a}-${missing}"}},
+	}
+
+	for i, cas := range cases {
+		t.Run(cas.format, func(t *testing.T) {
+			var got any
+
+			if err := Unmarshal([]byte(cas.in), cas.format, &got); err != nil {
+				t.Fatalf("%d: Unmarshal()=%+v", i, err)
+			}
+
+			if !cmp.Equal(got, any(cas.want)) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, any(cas.want)))
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	v := map[string]any{
+		"image": map[string]any{
+			"repo": "reflow",
+			"tag":  "v1.0.0",
+		},
+		"name": "a \"quoted\" value",
+	}
+
+	for _, format := range []string{"json", "yaml", "json5", "toml", "hcl", "properties"} {
+		t.Run(format, func(t *testing.T) {
+			p, err := Marshal(v, format)
+			if err != nil {
+				t.Fatalf("Marshal()=%+v", err)
+			}
+
+			var got map[string]any
+
+			if err := Unmarshal(p, format, &got); err != nil {
+				t.Fatalf("Unmarshal()=%+v:\n%s", err, p)
+			}
+
+			if !cmp.Equal(got, v) {
+				t.Fatalf("got != want:\n%s", cmp.Diff(got, v))
+			}
+		})
+	}
+}
+
+func TestMarshalTOMLNil(t *testing.T) {
+	v := map[string]any{
+		"image":  map[string]any{"repo": "reflow", "tag": nil},
+		"tags":   []any{"a", nil, "b"},
+		"digest": nil,
+	}
+
+	p, err := Marshal(v, "toml")
+	if err != nil {
+		t.Fatalf("Marshal()=%+v", err)
+	}
+
+	var got map[string]any
+
+	if err := Unmarshal(p, "toml", &got); err != nil {
+		t.Fatalf("Unmarshal()=%+v:\n%s", err, p)
+	}
+
+	want := map[string]any{
+		"image": map[string]any{"repo": "reflow"},
+		"tags":  []any{"a", "b"},
+	}
+
+	if !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	if _, ok := v["digest"]; !ok {
+		t.Fatal("Marshal() modified the value")
+	}
+}
+
+func TestGeneric(t *testing.T) {
+	type release struct {
+		Name   string   `json:"name"`
+		ID     int64    `json:"id"`
+		Assets []string `json:"assets,omitempty"`
+	}
+
+	cases := []struct {
+		v    any
+		want any
+	}{
+		0: {int64(3), 3},
+		1: {json.Number("3"), 3},
+		2: {json.Number("1.5"), 1.5},
+		3: {[]map[string]any{{"a": int64(1)}}, []any{map[string]any{"a": 1}}},
+		4: {map[string]any{"a": []any{json.Number("1")}}, map[string]any{"a": []any{1}}},
+		5: {&release{Name: "v1", ID: 42}, map[string]any{"name": "v1", "id": 42}},
+		6: {[]release{{Name: "v1"}}, []any{map[string]any{"name": "v1", "id": 0}}},
+		7: {(*release)(nil), nil},
+		8: {"v1", "v1"},
+	}
+
+	for i, cas := range cases {
+		got, err := Generic(cas.v)
+		if err != nil {
+			t.Fatalf("%d: Generic()=%+v", i, err)
+		}
+
+		if !cmp.Equal(got, cas.want) {
+			t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, cas.want))
+		}
+	}
+}
+
+func TestMarshalEnv(t *testing.T) {
+	v := map[string]any{
+		"image":    map[string]any{"tag": "v1.0.0"},
+		"replicas": 3,
+		"message":  "line 1\nline \"2\"",
+		"quote":    `it's $HOME \n`,
+	}
+
+	p, err := Marshal(v, ".env")
+	if err != nil {
+		t.Fatalf("Marshal()=%+v", err)
+	}
+
+	want := "IMAGE_TAG=v1.0.0\nMESSAGE='line 1\nline \"2\"'\nQUOTE='it'\\''s $HOME \\n'\nREPLICAS=3\n"
+
+	if got := string(p); got != want {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	var got map[string]any
+
+	if err := Unmarshal(p, "env", &got); err != nil {
+		t.Fatalf("Unmarshal()=%+v", err)
+	}
+
+	for k, want := range map[string]any{"MESSAGE": v["message"], "QUOTE": v["quote"]} {
+		if s := got[k]; s != want {
+			t.Fatalf("%s: got %q, want %q", k, s, want)
+		}
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	cases := []struct {
+		format string
+		in     string
+	}{
+		{"json5", "{a: Infinity}"},
+		{"json5", "{a: 'unterminated}"},
+		{"json5", "{a: 1 /* x"},
+		{"properties", "a=1\na.b=2\n"},
+		{"toml", "a = "},
+		{"xml", "<a/>"},
+	}
+
+	for _, cas := range cases {
+		var v any
+
+		if err := Unmarshal([]byte(cas.in), cas.format, &v); err == nil {
+			t.Errorf("Unmarshal(%q, %q): want error", cas.in, cas.format)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EnvVar is a variable of a flattened object.
+type EnvVar struct {
+	Key   string
+	Value string
+}
+
+// EnvVars flattens the object v into variables sorted by their keys,
+// with nested objects flattened into keys joined with underscores, e.g.
+// git_head, and other nested values, like lists, encoded as JSON. The
+// keys are converted with conv, if not nil.
+func EnvVars(v any, conv func(string) string) ([]EnvVar, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("cannot marshal non-object value")
+	}
+
+	if conv == nil {
+		conv = func(s string) string { return s }
+	}
+
+	var env []EnvVar
+
+	if err := flattenEnv(m, "", func(k, v string) {
+		env = append(env, EnvVar{Key: conv(k), Value: v})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(env, func(i, j int) bool {
+		return env[i].Key < env[j].Key
+	})
+
+	return env, nil
+}
+
+func flattenEnv(m map[string]any, prefix string, fn func(k, v string)) error {
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "_" + k
+		}
+
+		switch v := v.(type) {
+		case map[string]any:
+			if err := flattenEnv(v, k, fn); err != nil {
+				return err
+			}
+		case nil:
+			fn(k, "")
+		case string:
+			fn(k, v)
+		default:
+			p, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+
+			fn(k, string(p))
+		}
+	}
+
+	return nil
+}
+
+// MarshalDotenv marshals the variables into KEY=value lines, which are
+// both a valid dotenv file and a shell script: characters not allowed
+// in shell variable names are replaced in the keys, and the values are
+// single-quoted if they contain any characters special to the shell.
+// If export is true, each line is prefixed with export.
+func MarshalDotenv(env []EnvVar, export bool) []byte {
+	var buf bytes.Buffer
+
+	for _, e := range env {
+		if export {
+			buf.WriteString("export ")
+		}
+
+		fmt.Fprintf(&buf, "%s=%s\n", envKey(e.Key), shellQuote(e.Value))
+	}
+
+	return buf.Bytes()
+}
+
+func marshalEnv(v any) ([]byte, error) {
+	env, err := EnvVars(v, strings.ToUpper)
+	if err != nil {
+		return nil, err
+	}
+
+	return MarshalDotenv(env, false), nil
+}
+
+// envKey replaces characters not allowed in shell variable names.
+func envKey(k string) string {
+	k = strings.Map(func(r rune) rune {
+		if r == '_' || isAlnum(r) {
+			return r
+		}
+
+		return '_'
+	}, k)
+
+	if k == "" || (k[0] >= '0' && k[0] <= '9') {
+		k = "_" + k
+	}
+
+	return k
+}
+
+func isAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// shellQuote single-quotes the value, unless it consists of characters
+// safe in both shell and dotenv files only.
+func shellQuote(s string) string {
+	safe := s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !isAlnum(r) && !strings.ContainsRune("_-.,:/@%+", r)
+	}) == -1
+
+	if safe {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// unmarshalEnv parses KEY=value lines, optionally prefixed with export,
+// skipping blank lines and # comments. Values are read like the shell
+// does: single-quoted parts are taken literally, backslash escapes are
+// unescaped elsewhere, with \n and \r read as line breaks in double
+// quotes, and quoted parts can be concatenated, e.g. 'a'"b" reads ab,
+// and span lines. $VAR and ${VAR} outside single quotes are replaced
+// with the values of the variables defined earlier in the file.
+func unmarshalEnv(p []byte, v any) error {
+	var (
+		s    = string(p)
+		m    = make(map[string]any)
+		vars = make(map[string]string)
+	)
+
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+
+		if s == "" {
+			break
+		}
+
+		if s[0] == '#' {
+			s = skipLine(s)
+			continue
+		}
+
+		if rest := strings.TrimPrefix(s, "export"); rest != s && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			s = strings.TrimLeft(rest, " \t")
+		}
+
+		i := strings.IndexAny(s, "=\n")
+		if i == -1 || s[i] != '=' {
+			return fmt.Errorf("invalid line: %q", strings.TrimSpace(strings.SplitN(s, "\n", 2)[0]))
+		}
+
+		key := strings.TrimSpace(s[:i])
+		if key == "" {
+			return fmt.Errorf("missing key: %q", strings.SplitN(s, "\n", 2)[0])
+		}
+
+		value, rest, err := envValue(s[i+1:], vars)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		m[key] = value
+		vars[key] = value
+		s = rest
+	}
+
+	return assign(m, v)
+}
+
+// envValue reads the value s starts with, up to the end of its line,
+// and returns it along with the rest of s.
+func envValue(s string, vars map[string]string) (string, string, error) {
+	var (
+		buf   strings.Builder
+		space string
+	)
+
+	s = strings.TrimLeft(s, " \t")
+
+	for s != "" {
+		switch c := s[0]; c {
+		case '\n':
+			return buf.String(), s[1:], nil
+		case ' ', '\t', '\r':
+			i := strings.IndexFunc(s, func(r rune) bool { return r != ' ' && r != '\t' && r != '\r' })
+			if i == -1 {
+				i = len(s)
+			}
+
+			if i < len(s) && s[i] == '#' {
+				return buf.String(), skipLine(s), nil
+			}
+
+			space, s = s[:i], s[i:]
+			continue
+		case '\'':
+			i := strings.IndexByte(s[1:], '\'')
+			if i == -1 {
+				return "", "", errors.New("unterminated single quote")
+			}
+
+			buf.WriteString(space + s[1:1+i])
+			s = s[i+2:]
+		case '"':
+			buf.WriteString(space)
+
+			var i int
+
+			for i = 1; i < len(s) && s[i] != '"'; i++ {
+				switch s[i] {
+				case '\\':
+					if i++; i == len(s) {
+						break
+					}
+
+					switch s[i] {
+					case 'n':
+						buf.WriteByte('\n')
+					case 'r':
+						buf.WriteByte('\r')
+					default:
+						buf.WriteByte(s[i])
+					}
+				case '$':
+					n := expandVar(&buf, s[i:], vars)
+					i += n - 1
+				default:
+					buf.WriteByte(s[i])
+				}
+			}
+
+			if i >= len(s) {
+				return "", "", errors.New("unterminated double quote")
+			}
+
+			s = s[i+1:]
+		case '$':
+			buf.WriteString(space)
+			s = s[expandVar(&buf, s, vars):]
+		case '\\':
+			buf.WriteString(space)
+
+			switch {
+			case len(s) == 1:
+				s = ""
+			case s[1] == '\n':
+				s = s[2:]
+			default:
+				buf.WriteByte(s[1])
+				s = s[2:]
+			}
+		default:
+			buf.WriteString(space)
+			buf.WriteByte(c)
+			s = s[1:]
+		}
+
+		space = ""
+	}
+
+	return buf.String(), "", nil
+}
+
+// expandVar writes the value of the $VAR or ${VAR} reference s starts
+// with, or the $ if it is not a reference, and returns its length.
+func expandVar(buf *strings.Builder, s string, vars map[string]string) int {
+	name, n := s[1:], 1
+
+	if strings.HasPrefix(name, "{") {
+		i := strings.IndexByte(name, '}')
+		if i == -1 || !isVarName(name[1:i]) {
+			buf.WriteByte('$')
+			return 1
+		}
+
+		buf.WriteString(vars[name[1:i]])
+		return i + 2
+	}
+
+	for n < len(s) && isVarName(s[n:n+1]) {
+		n++
+	}
+
+	if n == 1 {
+		buf.WriteByte('$')
+		return 1
+	}
+
+	buf.WriteString(vars[s[1:n]])
+	return n
+}
+
+func isVarName(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return r != '_' && (r < 'A' || r > 'Z') && (r < '0' || r > '9')
+	}) == -1
+}
+
+func skipLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		return s[i+1:]
+	}
+
+	return ""
+}
@@ -0,0 +1,271 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+func marshalJSON5(v any) ([]byte, error) {
+	p, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(p, '\n'), nil
+}
+
+func unmarshalJSON5(p []byte, v any) error {
+	q, err := json5ToJSON(p)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(q, v)
+}
+
+// json5ToJSON rewrites JSON5 (and thus JSONC) input into plain JSON:
+// it strips comments and trailing commas, quotes identifier keys,
+// converts single-quoted strings and normalizes numbers.
+func json5ToJSON(p []byte) ([]byte, error) {
+	var (
+		out  bytes.Buffer
+		line = 1
+	)
+
+	errorf := func(format string, args ...any) error {
+		return fmt.Errorf("json5: line %d: "+format, append([]any{line}, args...)...)
+	}
+
+	for i := 0; i < len(p); {
+		c := p[i]
+
+		switch {
+		case c == '\n':
+			line++
+			out.WriteByte(c)
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			out.WriteByte(c)
+			i++
+		case c == '/' && i+1 < len(p) && p[i+1] == '/':
+			for i < len(p) && p[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(p) && p[i+1] == '*':
+			end := bytes.Index(p[i+2:], []byte("*/"))
+			if end == -1 {
+				return nil, errorf("unterminated comment")
+			}
+
+			line += bytes.Count(p[i:i+2+end], []byte("\n"))
+			i += end + 4
+		case c == ']' || c == '}':
+			trimComma(&out)
+			out.WriteByte(c)
+			i++
+		case c == '{' || c == '[' || c == ',' || c == ':':
+			out.WriteByte(c)
+			i++
+		case c == '"' || c == '\'':
+			s, n, err := json5String(p[i:])
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+
+			line += bytes.Count(p[i:i+n], []byte("\n"))
+			out.WriteString(strconv.Quote(s))
+			i += n
+		case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(p) && (isIdent(rune(p[j])) || p[j] == '.' || ((p[j] == '+' || p[j] == '-') && (p[j-1] == 'e' || p[j-1] == 'E'))) {
+				j++
+			}
+
+			s, err := json5Number(string(p[i:j]))
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+
+			out.WriteString(s)
+			i = j
+		default:
+			r, size := utf8.DecodeRune(p[i:])
+			if !isIdent(r) {
+				return nil, errorf("unexpected character %q", r)
+			}
+
+			j := i + size
+			for j < len(p) {
+				r, size := utf8.DecodeRune(p[j:])
+				if !isIdent(r) {
+					break
+				}
+				j += size
+			}
+
+			switch id := string(p[i:j]); {
+			case isKey(p[j:]):
+				out.WriteString(strconv.Quote(id))
+			case id == "true" || id == "false" || id == "null":
+				out.WriteString(id)
+			default:
+				return nil, errorf("unsupported value %q", id)
+			}
+
+			i = j
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func json5String(p []byte) (string, int, error) {
+	var (
+		quote = p[0]
+		buf   strings.Builder
+	)
+
+	for i := 1; i < len(p); i++ {
+		switch c := p[i]; c {
+		case quote:
+			return buf.String(), i + 1, nil
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '\\':
+			if i++; i == len(p) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+
+			switch c := p[i]; c {
+			case '\n':
+			case '\r':
+				if i+1 < len(p) && p[i+1] == '\n' {
+					i++
+				}
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'v':
+				buf.WriteByte('\v')
+			case '0':
+				buf.WriteByte(0)
+			case 'x', 'u':
+				n := 2
+				if c == 'u' {
+					n = 4
+				}
+
+				if i+n >= len(p) {
+					return "", 0, fmt.Errorf("invalid escape")
+				}
+
+				r, err := strconv.ParseUint(string(p[i+1:i+1+n]), 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape: %w", err)
+				}
+
+				buf.WriteRune(rune(r))
+				i += n
+			default:
+				buf.WriteByte(c)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func json5Number(s string) (string, error) {
+	var sign string
+
+	switch s[0] {
+	case '+':
+		s = s[1:]
+	case '-':
+		sign, s = "-", s[1:]
+	}
+
+	if l := strings.ToLower(s); strings.HasPrefix(l, "0x") {
+		n, err := strconv.ParseUint(l[2:], 16, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid number %q", s)
+		}
+
+		return sign + strconv.FormatUint(n, 10), nil
+	}
+
+	if strings.HasPrefix(s, ".") {
+		s = "0" + s
+	}
+
+	if strings.HasSuffix(s, ".") {
+		s += "0"
+	}
+
+	s = strings.Replace(s, ".e", ".0e", 1)
+	s = strings.Replace(s, ".E", ".0E", 1)
+
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return "", fmt.Errorf("invalid number %q", sign+s)
+	}
+
+	return sign + s, nil
+}
+
+func trimComma(buf *bytes.Buffer) {
+	p := bytes.TrimRight(buf.Bytes(), " \t\r\n")
+
+	if len(p) != 0 && p[len(p)-1] == ',' {
+		rest := append([]byte(nil), buf.Bytes()[len(p):]...)
+
+		buf.Truncate(len(p) - 1)
+		buf.Write(rest)
+	}
+}
+
+// isKey reports whether the remaining input starts with a colon,
+// ignoring whitespace and comments.
+func isKey(p []byte) bool {
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case c == ':':
+			return true
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		case c == '/' && i+1 < len(p) && p[i+1] == '/':
+			for i < len(p) && p[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(p) && p[i+1] == '*':
+			end := bytes.Index(p[i+2:], []byte("*/"))
+			if end == -1 {
+				return false
+			}
+
+			i += end + 3
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -1,17 +1,24 @@
 package context
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"rafal.dev/reflow/internal/misc"
+	"rafal.dev/reflow/pkg/codec"
 	"rafal.dev/reflow/pkg/debug"
+	"rafal.dev/reflow/pkg/keypath"
+	"rafal.dev/reflow/pkg/secret"
 	"rafal.dev/reflow/pkg/template"
-
-	"gopkg.in/yaml.v3"
 )
 
 var Builtin = []string{
@@ -21,10 +28,81 @@ var Builtin = []string{
 	"reflow",
 }
 
-var DefaultBuilder Builder = SeqBuilder{
-	&DirBuilder{Dir: misc.HomeDir("context")},
-	&ReflowBuilder{Client: misc.GitHub(context.Background())},
-	&DirBuilder{Dir: misc.HomeDir("templates"), Conv: Template, Exclude: Builtin},
+// Protected are the builtin keys, which user layers cannot set.
+var Protected = without(Builtin, "values")
+
+func without(keys []string, key string) []string {
+	var s []string
+
+	for _, k := range keys {
+		if k != key {
+			s = append(s, k)
+		}
+	}
+
+	return s
+}
+
+// DefaultBuilder is constructed on the first Build, so merely importing
+// the package neither creates the home directory nor a GitHub client.
+// The packages it depends on must not do either on init too, e.g. the
+// default secret key is loaded on first use.
+var DefaultBuilder = NewDefaultBuilder(&template.Default)
+
+// NewDefaultBuilder returns a builder like DefaultBuilder, which executes
+// templates with the options o points to. The options are read on the
+// first Build, so they can be set by command line flags until then.
+func NewDefaultBuilder(o *template.Options) Builder {
+	return &onceBuilder{fn: func() Builder { return defaultBuilder(*o) }}
+}
+
+func defaultBuilder(o template.Options) Builder {
+	var (
+		home          = misc.Home()
+		homeContext   = filepath.Join(home, "context")
+		homeTemplates = filepath.Join(home, "templates")
+		cache         = filepath.Join(home, "cache")
+		client        = misc.GitHub(context.Background())
+	)
+
+	repo := &RepoBuilder{
+		Client:   client,
+		CacheDir: cache,
+		Config:   filepath.Join(home, "repo.yaml"),
+	}
+
+	return SeqBuilder{
+		ParBuilder{
+			repo,
+			&DirBuilder{Dir: os.DirFS(homeContext), Path: homeContext, Recursive: true},
+		},
+		&EnvBuilder{GitHub: true},
+		&GitBuilder{},
+		&CacheBuilder{
+			Builder: &ReflowBuilder{Client: client},
+			Dir:     cache,
+			Keys:    []string{"github", "git.head"},
+		},
+		&ExecBuilder{Template: &o},
+		&HTTPBuilder{CacheDir: cache, Template: &o},
+		repo.Templates(TemplateWith(o)),
+		&DirBuilder{Dir: os.DirFS(homeTemplates), Path: homeTemplates, Conv: TemplateWith(o), Exclude: Builtin},
+		&SchemaBuilder{Dir: misc.HomeDir("schemas")},
+	}
+}
+
+type onceBuilder struct {
+	once sync.Once
+	fn   func() Builder
+	b    Builder
+}
+
+func (ob *onceBuilder) Build(ctx context.Context, m map[string]any) error {
+	ob.once.Do(func() {
+		ob.b = ob.fn()
+	})
+
+	return ob.b.Build(ctx, m)
 }
 
 type SeqBuilder []Builder
@@ -60,92 +138,365 @@ func Build(ctx context.Context) (map[string]any, error) {
 	return m, DefaultBuilder.Build(ctx, m)
 }
 
-func Template(p []byte, m map[string]any) ([]byte, error) {
-	q, err := template.Execute(string(p), m)
-	if err != nil {
-		return nil, fmt.Errorf("executing template: %w", err)
+// Template executes the file as a template with the default options.
+func Template(ctx context.Context, file string, p []byte, m map[string]any) ([]byte, error) {
+	return TemplateWith(template.Default)(ctx, file, p, m)
+}
+
+// TemplateWith returns a Conv executing files as templates with the options,
+// configured by the extension and the front matter of each file.
+func TemplateWith(o template.Options) func(context.Context, string, []byte, map[string]any) ([]byte, error) {
+	return func(ctx context.Context, file string, p []byte, m map[string]any) ([]byte, error) {
+		o, s, err := o.File(file, string(p))
+		if err != nil {
+			return nil, err
+		}
+
+		o.Context = ctx
+
+		q, err := o.Execute(s, m)
+		if err != nil {
+			return nil, fmt.Errorf("executing template: %w", err)
+		}
+
+		return q, nil
 	}
+}
+
+type skipConvKey struct{}
+
+// WithoutConv returns a context, which makes DirBuilders skip the files
+// they would convert, e.g. execute as templates, and set their keys to
+// template.Unknown instead. ExecBuilders and HTTPBuilders likewise skip
+// running commands and fetching endpoints, which could have side effects.
+// It is used to build a context for linting the templates without
+// executing them.
+func WithoutConv(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipConvKey{}, true)
+}
 
-	return q, nil
+func skipConv(ctx context.Context) bool {
+	ok, _ := ctx.Value(skipConvKey{}).(bool)
+	return ok
 }
 
+// DirBuilder loads each file found in the Dir under the key named
+// after the file, e.g. values.yaml is loaded under values.
+//
+// If Recursive is true, nested directories are loaded under nested
+// keys, e.g. env/prod/db.yaml is loaded under env.prod.db. Files are
+// loaded in lexical order, shallower files first, so the more specific
+// files override less specific ones. Symlinked directories are followed
+// only if FollowSymlinks is true.
+//
+// The Include and Exclude are path.Match patterns matched against the
+// slash-separated file paths relative to the Dir, with or without the
+// extension; a pattern matching a directory matches all files beneath
+// it. If Include is not empty, only the matching files are loaded.
+//
+// The Conv, if set, converts the content of each file before it is
+// loaded, e.g. executes it as a template.
+//
+// The Path, if set, is the directory the Dir was opened from. It prefixes
+// the files in the recorded origins and errors, and is used to resolve
+// symlinks when detecting loops.
 type DirBuilder struct {
-	Dir     fs.FS
-	Exclude []string
-	Conv    func([]byte, map[string]any) ([]byte, error)
+	Dir            fs.FS
+	Path           string
+	Include        []string
+	Exclude        []string
+	Recursive      bool
+	FollowSymlinks bool
+	Conv           func(ctx context.Context, file string, p []byte, m map[string]any) ([]byte, error)
+	Key            *secret.Key
+	Merge          *Merger
 }
 
 func (db *DirBuilder) Build(ctx context.Context, m map[string]any) error {
-	entries, err := fs.ReadDir(db.Dir, ".")
+	files, err := db.files(ctx)
 	if err != nil {
 		return fmt.Errorf("dir loader: %w", err)
 	}
 
-	debug.Logf(ctx, "%T: found %d entries", db, len(entries))
+	debug.Logf(ctx, "%T: found %d files", db, len(files))
 
-	for _, entry := range entries {
+	for _, file := range files {
 		select {
 		case <-ctx.Done():
 			return fmt.Errorf("dir loader: %w", ctx.Err())
 		default:
 		}
 
-		if entry.IsDir() {
-			continue
-		}
-
-		debug.Logf(ctx, "%T: building %q", db, entry.Name())
+		debug.Logf(ctx, "%T: building %q", db, file)
 
 		var (
-			unmarshal func([]byte, any) error
-			key       = strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+			unmarshal func([]byte, *any) error
+			keys      = fileKeys(file)
+			key       = joinKeys(keys)
 		)
 
-		if db.isExcluded(key) {
-			debug.Logf(ctx, "%T: excluding %q", db, entry.Name())
-			continue
-		}
-
-		switch ext := strings.ToLower(filepath.Ext(entry.Name())); ext {
+		switch ext := strings.ToLower(path.Ext(file)); ext {
 		case ".json", ".yaml", ".yml":
-			unmarshal = yaml.Unmarshal
+			unmarshal = unmarshalYAML
 		default:
-			debug.Logf(ctx, "%T: no unmarshal found for %q", db, ext)
+			if c, ok := codec.Lookup(ext); ok {
+				unmarshal = func(p []byte, v *any) error { return c.Unmarshal(p, v) }
+			} else {
+				debug.Logf(ctx, "%T: no unmarshal found for %q", db, ext)
+			}
 		}
 
 		if unmarshal == nil {
 			continue
 		}
 
-		p, err := fs.ReadFile(db.Dir, entry.Name())
+		if db.Conv != nil && skipConv(ctx) {
+			debug.Logf(ctx, "%T: skipping conv of %q", db, file)
+
+			dst, err := nest(m, keys[:len(keys)-1])
+			if err != nil {
+				return fmt.Errorf("dir loader %q: %w", file, err)
+			}
+
+			db.merger().Merge(dst, keys[len(keys)-1], template.Unknown)
+			continue
+		}
+
+		p, err := fs.ReadFile(db.Dir, file)
 		if err != nil {
-			return fmt.Errorf("dir loader %q: %w", entry.Name(), err)
+			return fmt.Errorf("dir loader %q: %w", file, err)
+		}
+
+		if p, err = db.Key.Open(p); err != nil {
+			return fmt.Errorf("dir loader %q: %w", file, err)
 		}
 
+		src := p
+
 		if db.Conv != nil {
-			if p, err = db.Conv(p, m); err != nil {
-				return fmt.Errorf("dir loader %q: %w", entry.Name(), err)
+			if p, err = db.Conv(ctx, file, p, m); err != nil {
+				var te *template.Error
+				if errors.As(err, &te) && te.Name == "" {
+					te.Name = sourceFile(db.Path, filepath.FromSlash(file))
+
+					return fmt.Errorf("dir loader: %w", te)
+				}
+
+				return fmt.Errorf("dir loader %q: %w", file, err)
 			}
 		}
 
+		if len(bytes.TrimSpace(p)) == 0 {
+			debug.Logf(ctx, "%T: skipping empty %q", db, file)
+			continue
+		}
+
 		var v any
 
 		if err := unmarshal(p, &v); err != nil {
-			return fmt.Errorf("dir loader %q: %w", entry.Name(), err)
+			return fmt.Errorf("dir loader %q: %w", file, err)
+		}
+
+		dst, err := nest(m, keys[:len(keys)-1])
+		if err != nil {
+			return fmt.Errorf("dir loader %q: %w", file, err)
 		}
 
-		m[key] = v
+		db.merger().Merge(dst, keys[len(keys)-1], v)
+
+		if prov := ProvenanceFrom(ctx); prov != nil {
+			o := Origin{
+				Builder:   fmt.Sprintf("%T", db),
+				Source:    sourceFile(db.Path, filepath.FromSlash(file)),
+				Templated: db.Conv != nil,
+			}
+
+			recordLines(prov, key, v, o, sourceLines(key, file, src, db.Conv != nil))
+			prov.AddLayer(Layer{Key: key, Source: o.Source, Value: v})
+		}
 	}
 
 	return nil
 }
 
-func (db *DirBuilder) isExcluded(s string) bool {
-	for _, ex := range db.Exclude {
-		if ex == s {
-			return true
+// files returns paths of the files to load, ordered by depth
+// and then lexically.
+func (db *DirBuilder) files(ctx context.Context) ([]string, error) {
+	var (
+		files []string
+		stack = make(map[string]bool)
+	)
+
+	var walk func(dir string, depth int) error
+
+	walk = func(dir string, depth int) error {
+		entries, err := fs.ReadDir(db.Dir, dir)
+		if err != nil {
+			return err
+		}
+
+		if real := db.realPath(dir); real != "" {
+			stack[real] = true
+			defer delete(stack, real)
+		}
+
+		for _, entry := range entries {
+			file := path.Join(dir, entry.Name())
+
+			if db.match(db.Exclude, file) {
+				debug.Logf(ctx, "%T: excluding %q", db, file)
+				continue
+			}
+
+			isDir := entry.IsDir()
+
+			if entry.Type()&fs.ModeSymlink != 0 {
+				fi, err := fs.Stat(db.Dir, file)
+				if err != nil {
+					debug.Logf(ctx, "%T: skipping broken symlink %q: %s", db, file, err)
+					continue
+				}
+
+				if isDir = fi.IsDir(); isDir && !db.FollowSymlinks {
+					debug.Logf(ctx, "%T: skipping symlinked directory %q", db, file)
+					continue
+				}
+			}
+
+			if !isDir {
+				if len(db.Include) == 0 || db.match(db.Include, file) {
+					files = append(files, file)
+				}
+
+				continue
+			}
+
+			if !db.Recursive {
+				continue
+			}
+
+			if depth >= maxDirDepth {
+				return fmt.Errorf("%q: maximum directory depth of %d exceeded", file, maxDirDepth)
+			}
+
+			if stack[db.realPath(file)] {
+				debug.Logf(ctx, "%T: skipping symlink loop %q", db, file)
+				continue
+			}
+
+			if err := walk(file, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(".", 0); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		di, dj := strings.Count(files[i], "/"), strings.Count(files[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return files[i] < files[j]
+	})
+
+	return files, nil
+}
+
+const maxDirDepth = 32
+
+// realPath resolves symlinks of the file if the Path is set,
+// otherwise loops are bounded by maxDirDepth only.
+func (db *DirBuilder) realPath(file string) string {
+	if db.Path == "" {
+		return ""
+	}
+
+	real, err := filepath.EvalSymlinks(filepath.Join(db.Path, filepath.FromSlash(file)))
+	if err != nil {
+		return ""
+	}
+
+	return real
+}
+
+func (db *DirBuilder) match(patterns []string, file string) bool {
+	var (
+		noext = strings.TrimSuffix(file, path.Ext(file))
+		names = []string{file, noext}
+	)
+
+	for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+		names = append(names, dir)
+	}
+
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
 		}
 	}
 
 	return false
 }
+
+// fileKeys returns the keys of the file, without its extension and
+// the inner .tmpl one, so deploy.tmpl.yaml is loaded under deploy.
+// Dotfiles consisting of an extension only, like .env, are loaded under
+// the extension.
+func fileKeys(file string) []string {
+	var (
+		ext  = path.Ext(file)
+		name = strings.TrimSuffix(strings.TrimSuffix(file, ext), ".tmpl")
+	)
+
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += strings.TrimPrefix(ext, ".")
+	}
+
+	return strings.Split(name, "/")
+}
+
+func joinKeys(keys []string) string {
+	s := make([]string, len(keys))
+
+	for i, k := range keys {
+		s[i] = keypath.Join(k)
+	}
+
+	return strings.Join(s, ".")
+}
+
+// nest returns the map under the keys, creating the missing ones.
+// It fails if any of the keys already holds a value other than a map,
+// unless the value is unknown to Lint.
+func nest(m map[string]any, keys []string) (map[string]any, error) {
+	for i, k := range keys {
+		n, ok := m[k].(map[string]any)
+		if !ok {
+			if v := m[k]; v != nil && v != template.Unknown {
+				return nil, fmt.Errorf("%s: conflicts with existing %T value", joinKeys(keys[:i+1]), v)
+			}
+
+			n = make(map[string]any)
+			m[k] = n
+		}
+
+		m = n
+	}
+
+	return m, nil
+}
+
+func (db *DirBuilder) merger() *Merger {
+	if db.Merge != nil {
+		return db.Merge
+	}
+
+	return DefaultMerger
+}
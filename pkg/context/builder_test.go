@@ -0,0 +1,201 @@
+package context
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDirBuilder(t *testing.T) {
+	dir := fstest.MapFS{
+		"values.yaml":            {Data: []byte("replicas: 1\nenv: dev\n")},
+		"env.yaml":               {Data: []byte("prod:\n  db:\n    host: default\n    port: 5432\n")},
+		"env/prod/db.yaml":       {Data: []byte("host: db.prod\n")},
+		"env/prod/cache.toml":    {Data: []byte("ttl = 60\n")},
+		"env/dev/db.yaml":        {Data: []byte("host: db.dev\n")},
+		"env/dev/secret.yaml":    {Data: []byte("password: x\n")},
+		"github/event.json":      {Data: []byte(`{"action": "opened"}`)},
+		"values/overrides.yaml":  {Data: []byte("replicas: 3\n")},
+		"env/prod/README.md":     {Data: []byte("# docs\n")},
+		"env/prod/nested/a.yaml": {Data: []byte("b: c\n")},
+	}
+
+	cases := []struct {
+		b    *DirBuilder
+		want map[string]any
+	}{
+		0: {
+			&DirBuilder{Dir: dir},
+			map[string]any{
+				"values": map[string]any{"replicas": 1, "env": "dev"},
+				"env": map[string]any{
+					"prod": map[string]any{"db": map[string]any{"host": "default", "port": 5432}},
+				},
+			},
+		},
+		1: {
+			&DirBuilder{Dir: dir, Recursive: true, Exclude: []string{"github", "*/*/secret", "env/prod/nested"}},
+			map[string]any{
+				"values": map[string]any{"replicas": 1, "env": "dev", "overrides": map[string]any{"replicas": 3}},
+				"env": map[string]any{
+					"prod": map[string]any{
+						"db":    map[string]any{"host": "db.prod", "port": 5432},
+						"cache": map[string]any{"ttl": 60},
+					},
+					"dev": map[string]any{"db": map[string]any{"host": "db.dev"}},
+				},
+			},
+		},
+		2: {
+			&DirBuilder{Dir: dir, Recursive: true, Include: []string{"env/*/db.yaml", "github"}},
+			map[string]any{
+				"env": map[string]any{
+					"prod": map[string]any{"db": map[string]any{"host": "db.prod"}},
+					"dev":  map[string]any{"db": map[string]any{"host": "db.dev"}},
+				},
+				"github": map[string]any{"event": map[string]any{"action": "opened"}},
+			},
+		},
+		3: {
+			&DirBuilder{Dir: fstest.MapFS{
+				"deploy.tmpl.yaml": {Data: []byte("run: echo ${{ github.sha }} {{ len \"abc\" }}\n")},
+				"chart.yaml":       {Data: []byte("---\ndelims: [\"[[\", \"]]\"]\n---\nname: '{{ x }}-[[ len \"ab\" ]]'\n")},
+			}, Conv: Template},
+			map[string]any{
+				"deploy": map[string]any{"run": "echo ${{ github.sha }} 3"},
+				"chart":  map[string]any{"name": "{{ x }}-2"},
+			},
+		},
+		4: {
+			&DirBuilder{Dir: fstest.MapFS{
+				".env":       {Data: []byte("DEBUG=1\n")},
+				"app/.env":   {Data: []byte("PORT=8080\n")},
+				"app/.props": {Data: []byte("x\n")},
+			}, Recursive: true},
+			map[string]any{
+				"env": map[string]any{"DEBUG": "1"},
+				"app": map[string]any{"env": map[string]any{"PORT": "8080"}},
+			},
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			got := make(map[string]any)
+
+			if err := cas.b.Build(context.Background(), got); err != nil {
+				t.Fatalf("%d: Build()=%+v", i, err)
+			}
+
+			if !cmp.Equal(got, cas.want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, cas.want))
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	if os.Getenv("REFLOW_TEST_IMPORT") != "" {
+		return
+	}
+
+	home := filepath.Join(t.TempDir(), "home")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestImport$")
+	cmd.Env = append(os.Environ(), "REFLOW_TEST_IMPORT=1", "REFLOW_HOME="+home)
+
+	if p, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s: %+v\n%s", cmd, err, p)
+	}
+
+	if _, err := os.Stat(home); !os.IsNotExist(err) {
+		t.Fatalf("Stat()=%v, want the home directory not to be created on import", err)
+	}
+}
+
+func TestDirBuilderConflict(t *testing.T) {
+	b := &DirBuilder{Dir: fstest.MapFS{
+		"env.yaml":    {Data: []byte("prod\n")},
+		"env/db.yaml": {Data: []byte("host: db\n")},
+	}, Recursive: true}
+
+	err := b.Build(context.Background(), make(map[string]any))
+	if err == nil {
+		t.Fatal("Build(): want error")
+	}
+
+	if got, want := err.Error(), `dir loader "env/db.yaml": env: conflicts with existing string value`; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestDirBuilderSymlinks(t *testing.T) {
+	dir := t.TempDir()
+
+	mustWrite := func(file, data string) {
+		t.Helper()
+
+		file = filepath.Join(dir, file)
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("MkdirAll()=%+v", err)
+		}
+
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatalf("WriteFile()=%+v", err)
+		}
+	}
+
+	mustWrite("shared/db.yaml", "host: shared\n")
+	mustWrite("values.yaml", "replicas: 1\n")
+
+	for old, new := range map[string]string{
+		"shared":      "env",
+		"shared/..":   "shared/loop",
+		"values.yaml": "alias.yaml",
+	} {
+		if err := os.Symlink(filepath.Join(dir, old), filepath.Join(dir, new)); err != nil {
+			t.Skipf("Symlink()=%+v", err)
+		}
+	}
+
+	cases := []struct {
+		b    *DirBuilder
+		want map[string]any
+	}{
+		0: {
+			&DirBuilder{Dir: os.DirFS(dir), Path: dir, Recursive: true},
+			map[string]any{
+				"alias":  map[string]any{"replicas": 1},
+				"values": map[string]any{"replicas": 1},
+				"shared": map[string]any{"db": map[string]any{"host": "shared"}},
+			},
+		},
+		1: {
+			&DirBuilder{Dir: os.DirFS(dir), Path: dir, Recursive: true, FollowSymlinks: true, Exclude: []string{"alias", "values"}},
+			map[string]any{
+				"env":    map[string]any{"db": map[string]any{"host": "shared"}},
+				"shared": map[string]any{"db": map[string]any{"host": "shared"}},
+			},
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			got := make(map[string]any)
+
+			if err := cas.b.Build(context.Background(), got); err != nil {
+				t.Fatalf("%d: Build()=%+v", i, err)
+			}
+
+			if !cmp.Equal(got, cas.want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, cas.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package context
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"rafal.dev/reflow/pkg/codec"
+	"rafal.dev/reflow/pkg/debug"
+	"rafal.dev/reflow/pkg/lazy"
+)
+
+// CacheBuilder caches the values set by the Builder in the Dir, so
+// repeated invocations with the same inputs do not rebuild them, e.g.
+// do not refetch the pull request with the GitHub API.
+//
+// The cache is content-addressed: entries are keyed by a hash of the
+// builder type, the values under the Keys in the context, such as the
+// event payload under github.event, and the sizes and modification times
+// of the Files. Entries older than the TTL, 10 minutes by default, are
+// rebuilt. Failed builds are not cached. The values are written to the
+// Dir in plain text, so the Builder must not set any secrets.
+//
+// Lazy values set by the Builder stay lazy: each one is written to the
+// cache once resolved, and if it was not resolved before, a cache hit
+// reruns the Builder only when the value is used.
+type CacheBuilder struct {
+	Builder Builder
+	Dir     string
+	Keys    []string
+	Files   []string
+	TTL     time.Duration
+
+	mu sync.Mutex
+}
+
+var _ Builder = (*CacheBuilder)(nil)
+
+type buildEntry struct {
+	Builder string         `json:"builder"`
+	Created time.Time      `json:"created"`
+	Values  map[string]any `json:"values"`
+	Deleted []string       `json:"deleted,omitempty"`
+	Lazy    []string       `json:"lazy,omitempty"`
+}
+
+func (cb *CacheBuilder) Build(ctx context.Context, m map[string]any) error {
+	if cb.Dir == "" {
+		return cb.Builder.Build(ctx, m)
+	}
+
+	key, err := cb.key(m)
+	if err != nil {
+		return fmt.Errorf("cache builder: %w", err)
+	}
+
+	var (
+		file = filepath.Join(cb.Dir, "builds", key+".json")
+		snap = unwrap(m).(map[string]any)
+	)
+
+	if entry := cb.read(ctx, file); entry != nil && time.Since(entry.Created) < cb.ttl() {
+		debug.Logf(ctx, "%T: using cached %s", cb, entry.Builder)
+
+		apply(m, entry.Values, DefaultMerger)
+
+		for _, path := range entry.Deleted {
+			if _, err := Del(m, path); err != nil {
+				return fmt.Errorf("cache builder: %w", err)
+			}
+		}
+
+		for k, v := range entry.Values {
+			record(ctx, joinKeys([]string{k}), v, Origin{Builder: entry.Builder, Source: file})
+		}
+
+		rebuild := lazy.New(func() (any, error) {
+			debug.Logf(ctx, "%T: rebuilding %s", cb, entry.Builder)
+
+			m := unwrap(snap).(map[string]any)
+
+			if err := cb.Builder.Build(WithProvenance(ctx, nil), m); err != nil {
+				return nil, err
+			}
+
+			return m, nil
+		})
+
+		for _, path := range entry.Lazy {
+			path := path
+
+			lv := lazy.New(func() (any, error) {
+				m, err := rebuild.Get()
+				if err != nil {
+					return nil, err
+				}
+
+				return Get[any](m.(map[string]any), path)
+			})
+
+			if err := cb.setLazy(ctx, m, file, path, lv, Origin{Builder: entry.Builder, Source: file}); err != nil {
+				return fmt.Errorf("cache builder: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	if err := cb.Builder.Build(ctx, m); err != nil {
+		return err
+	}
+
+	var (
+		delta   = diff(snap, m)
+		deleted []string
+		values  = plain(delta, nil, &deleted)
+		lazies  = make(map[string]*lazy.Value)
+		paths   []string
+	)
+
+	sort.Strings(deleted)
+
+	findLazy(delta, nil, lazies)
+
+	for path := range lazies {
+		paths = append(paths, path)
+
+		if _, err := Del(values, path); err != nil {
+			return fmt.Errorf("cache builder: %w", err)
+		}
+	}
+
+	sort.Strings(paths)
+
+	cb.write(ctx, file, &buildEntry{
+		Builder: fmt.Sprintf("%T", cb.Builder),
+		Created: time.Now(),
+		Values:  values,
+		Deleted: deleted,
+		Lazy:    paths,
+	})
+
+	for _, path := range paths {
+		if err := cb.setLazy(ctx, m, file, path, lazies[path], Origin{}); err != nil {
+			return fmt.Errorf("cache builder: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// setLazy sets a lazy value under the path, which updates
+// the cache entry once resolved.
+func (cb *CacheBuilder) setLazy(ctx context.Context, m map[string]any, file, path string, lv *lazy.Value, o Origin) error {
+	v := lazy.New(func() (any, error) {
+		v, err := lv.Get()
+		if err != nil {
+			return nil, err
+		}
+
+		cb.update(ctx, file, path, v)
+
+		return v, nil
+	})
+
+	if _, err := Set(m, path, v); err != nil {
+		return err
+	}
+
+	if o.Builder != "" {
+		record(ctx, path, v, o)
+	}
+
+	return nil
+}
+
+func (cb *CacheBuilder) update(ctx context.Context, file, path string, v any) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	entry := cb.read(ctx, file)
+	if entry == nil {
+		return
+	}
+
+	for i, p := range entry.Lazy {
+		if p == path {
+			entry.Lazy = append(entry.Lazy[:i], entry.Lazy[i+1:]...)
+			break
+		}
+	}
+
+	if entry.Values == nil {
+		entry.Values = make(map[string]any)
+	}
+
+	if _, err := Set(entry.Values, path, v); err != nil {
+		debug.Logf(ctx, "%T: not updating %q: %s", cb, path, err)
+		return
+	}
+
+	cb.write(ctx, file, entry)
+}
+
+func (cb *CacheBuilder) key(m map[string]any) (string, error) {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%T\n", cb.Builder)
+
+	for _, k := range cb.Keys {
+		v, err := Get[any](m, k)
+		var ke *KeyError
+		if errors.As(err, &ke) {
+			fmt.Fprintf(h, "%s: -\n", k)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		p, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("hashing %q: %w", k, err)
+		}
+
+		fmt.Fprintf(h, "%s: %s\n", k, p)
+	}
+
+	for _, file := range cb.Files {
+		fi, err := os.Stat(file)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(h, "%s: -\n", file)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "%s: %d %d\n", file, fi.Size(), fi.ModTime().UnixNano())
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (cb *CacheBuilder) read(ctx context.Context, file string) *buildEntry {
+	p, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	var (
+		entry buildEntry
+		dec   = json.NewDecoder(bytes.NewReader(p))
+	)
+
+	dec.UseNumber()
+
+	if err := dec.Decode(&entry); err != nil {
+		debug.Logf(ctx, "%T: ignoring invalid cache %q: %s", cb, file, err)
+		return nil
+	}
+
+	if _, err := codec.Generic(entry.Values); err != nil {
+		debug.Logf(ctx, "%T: ignoring invalid cache %q: %s", cb, file, err)
+		return nil
+	}
+
+	return &entry
+}
+
+func (cb *CacheBuilder) write(ctx context.Context, file string, entry *buildEntry) {
+	p, err := json.Marshal(entry)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(file), 0700); err == nil {
+			err = os.WriteFile(file, p, 0600)
+		}
+	}
+
+	if err != nil {
+		debug.Logf(ctx, "%T: unable to write cache %q: %s", cb, file, err)
+	}
+}
+
+func (cb *CacheBuilder) ttl() time.Duration {
+	if cb.TTL != 0 {
+		return cb.TTL
+	}
+
+	return 10 * time.Minute
+}
+
+// plain converts the delta to values, which can be stored in the cache,
+// with the extended lists replaced by their final values, and appends
+// the paths of the deleted keys to the dels.
+func plain(delta map[string]any, keys []string, dels *[]string) map[string]any {
+	m := make(map[string]any, len(delta))
+
+	for k, v := range delta {
+		keys := append(keys[:len(keys):len(keys)], k)
+
+		switch v := v.(type) {
+		case deleted:
+			*dels = append(*dels, joinKeys(keys))
+		case extended:
+			m[k] = unwrap(v.List)
+		case map[string]any:
+			m[k] = plain(v, keys, dels)
+		default:
+			m[k] = unwrap(v)
+		}
+	}
+
+	return m
+}
+
+// findLazy finds the lazy values nested in maps.
+func findLazy(m map[string]any, keys []string, lazies map[string]*lazy.Value) {
+	for k, v := range m {
+		keys := append(keys[:len(keys):len(keys)], k)
+
+		switch v := v.(type) {
+		case *lazy.Value:
+			lazies[joinKeys(keys)] = v
+		case map[string]any:
+			findLazy(v, keys, lazies)
+		}
+	}
+}
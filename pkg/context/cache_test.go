@@ -0,0 +1,155 @@
+package context
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rafal.dev/reflow/pkg/lazy"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCacheBuilder(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		file   = filepath.Join(dir, "event.json")
+		builds int
+	)
+
+	if err := os.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	cb := &CacheBuilder{
+		Builder: builderFunc(func(_ context.Context, m map[string]any) error {
+			builds++
+
+			sha, err := Get[string](m, "github.sha")
+			if err != nil {
+				return err
+			}
+
+			Set(m, "reflow.sha", sha)
+			Set(m, "reflow.number", 42)
+			Set(m, "reflow.labels", []any{"bug"})
+			Del(m, "stale")
+
+			return nil
+		}),
+		Dir:   dir,
+		Keys:  []string{"github", "git.head"},
+		Files: []string{file},
+	}
+
+	build := func(sha string) map[string]any {
+		t.Helper()
+
+		m := map[string]any{
+			"github": map[string]any{"sha": sha},
+			"stale":  true,
+		}
+
+		if err := cb.Build(context.Background(), m); err != nil {
+			t.Fatalf("Build()=%s", err)
+		}
+
+		return m
+	}
+
+	want := func(sha string) map[string]any {
+		return map[string]any{
+			"github": map[string]any{"sha": sha},
+			"reflow": map[string]any{"sha": sha, "number": 42, "labels": []any{"bug"}},
+		}
+	}
+
+	cases := []struct {
+		setup  func()
+		sha    string
+		builds int
+	}{
+		{nil, "abc", 1},
+		{nil, "abc", 1},
+		{nil, "def", 2},
+		{func() { os.Chtimes(file, time.Now(), time.Now().Add(time.Hour)) }, "def", 3},
+		{func() { cb.TTL = time.Nanosecond }, "def", 4},
+	}
+
+	for _, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			if cas.setup != nil {
+				cas.setup()
+			}
+
+			if got, want := build(cas.sha), want(cas.sha); !cmp.Equal(got, want) {
+				t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+			}
+
+			if builds != cas.builds {
+				t.Fatalf("got %d builds, want %d", builds, cas.builds)
+			}
+		})
+	}
+
+	if err := cb.Build(context.Background(), map[string]any{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCacheBuilderLazy(t *testing.T) {
+	var builds, fetches int
+
+	cb := &CacheBuilder{
+		Builder: builderFunc(func(_ context.Context, m map[string]any) error {
+			builds++
+
+			Set(m, "reflow.owner", "o")
+			Set(m, "reflow.sha", lazy.New(func() (any, error) {
+				fetches++
+				return "abc", nil
+			}))
+
+			return nil
+		}),
+		Dir:  t.TempDir(),
+		Keys: []string{"github"},
+	}
+
+	cases := []struct {
+		resolve bool
+		builds  int
+		fetches int
+	}{
+		{false, 1, 0},
+		{false, 1, 0},
+		{true, 2, 1},
+		{true, 2, 1},
+	}
+
+	for _, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			m := map[string]any{"github": map[string]any{"sha": "abc"}}
+
+			if err := cb.Build(context.Background(), m); err != nil {
+				t.Fatalf("Build()=%s", err)
+			}
+
+			if owner, err := Get[string](m, "reflow.owner"); err != nil || owner != "o" {
+				t.Fatalf("got %q, %v, want %q", owner, err, "o")
+			}
+
+			if cas.resolve {
+				if sha, err := Get[string](m, "reflow.sha"); err != nil || sha != "abc" {
+					t.Fatalf("got %q, %v, want %q", sha, err, "abc")
+				}
+			}
+
+			if builds != cas.builds || fetches != cas.fetches {
+				t.Fatalf("got %d builds and %d fetches, want %d and %d", builds, fetches, cas.builds, cas.fetches)
+			}
+		})
+	}
+}
@@ -1,9 +1,10 @@
 package context
 
 import (
-	"errors"
 	"fmt"
-	"strings"
+
+	"rafal.dev/reflow/pkg/keypath"
+	"rafal.dev/reflow/pkg/lazy"
 )
 
 type KeyError struct {
@@ -20,27 +21,39 @@ func (ke *KeyError) Error() string {
 	return fmt.Sprintf("key %q is missing", ke.Key)
 }
 
+// Get returns the value under the path, which follows the keypath
+// syntax. For paths containing wildcards the value is a []any of all
+// the matched values. Lazy values along the path and under it are
+// resolved first.
 func Get[T any](m map[string]any, path string) (t T, err error) {
+	p, err := keypath.Parse(path)
+	if err != nil {
+		return t, err
+	}
+
+	if _, err := resolve(m, p); err != nil {
+		return t, fmt.Errorf("key %q: %w", path, err)
+	}
+
 	var (
-		keys = strings.Split(path, ".")
-		n    = len(keys) - 1
-		it   = m
-		ok   bool
+		matches = keypath.Lookup(m, p)
+		v       any
+		ok      bool
 	)
 
-	if n < 0 {
-		return t, errors.New("empty key")
-	}
+	switch {
+	case p.Wildcard():
+		list := make([]any, 0, len(matches))
 
-	for _, k := range keys[:n] {
-		if it, ok = it[k].(map[string]any); !ok {
-			return t, &KeyError{Key: path, Type: fmt.Sprintf("%T", t)}
+		for _, m := range matches {
+			list = append(list, m.Value)
 		}
-	}
 
-	v, ok := it[keys[n]]
-	if !ok {
+		v = list
+	case len(matches) == 0:
 		return t, &KeyError{Key: path, Type: fmt.Sprintf("%T", t)}
+	default:
+		v = matches[0].Value
 	}
 
 	if t, ok = v.(T); !ok {
@@ -50,60 +63,124 @@ func Get[T any](m map[string]any, path string) (t T, err error) {
 	return t, nil
 }
 
-func Set[T any](m map[string]any, path string, t T) (replaced bool) {
-	var (
-		keys = strings.Split(path, ".")
-		n    = len(keys) - 1
-		it   = m
-	)
+// Lookup returns all the values matching the path along with their
+// concrete paths.
+func Lookup(m map[string]any, path string) ([]keypath.Match, error) {
+	p, err := keypath.Parse(path)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, k := range keys[:n] {
-		switch m := it[k].(type) {
-		case map[string]any:
-			if m == nil {
-				m = make(map[string]any)
-				it[k] = m
-			}
+	if _, err := resolve(m, p); err != nil {
+		return nil, fmt.Errorf("key %q: %w", path, err)
+	}
+
+	return keypath.Lookup(m, p), nil
+}
+
+// resolve resolves in place the lazy values along the path
+// and all the ones nested under it.
+func resolve(v any, p keypath.Path) (any, error) {
+	if len(p) == 0 {
+		return lazy.Resolve(v)
+	}
 
-			it = m
-		case nil:
-			n := make(map[string]any)
-			it[k] = n
-			it = n
-		default:
-			replaced = true
-			n := make(map[string]any)
-			it[k] = n
-			it = n
+	v, err := lazy.Get(v)
+	if err != nil {
+		return nil, err
+	}
+
+	s := p[0]
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, w := range v {
+			if s.Kind == keypath.Wildcard || (s.Kind == keypath.Key && s.Key == k) {
+				x, err := resolve(w, p[1:])
+				if err != nil {
+					return nil, err
+				}
+
+				v[k] = x
+			}
+		}
+	case []any:
+		for i, w := range v {
+			if s.Kind == keypath.Wildcard || (s.Kind != keypath.Key || s.Numeric) && (s.Index == i || s.Index == i-len(v)) {
+				x, err := resolve(w, p[1:])
+				if err != nil {
+					return nil, err
+				}
+
+				v[i] = x
+			}
 		}
 	}
 
-	if _, ok := it[keys[n]]; ok {
-		replaced = true
+	return v, nil
+}
+
+// Set sets the value under the path and returns whether an existing
+// value was replaced.
+func Set[T any](m map[string]any, path string, t T) (replaced bool, err error) {
+	p, err := keypath.Parse(path)
+	if err != nil {
+		return false, err
 	}
 
-	it[keys[n]] = t
+	if _, replaced, err = keypath.Set(m, p, t); err != nil {
+		return false, fmt.Errorf("key %q: %w", path, err)
+	}
 
-	return replaced
+	return replaced, nil
 }
 
-func Del(m map[string]any, path string) (ok bool) {
-	var (
-		keys = strings.Split(path, ".")
-		n    = len(keys) - 1
-		it   = m
-	)
+// Del deletes all the values matching the path and returns whether
+// anything was deleted.
+func Del(m map[string]any, path string) (ok bool, err error) {
+	p, err := keypath.Parse(path)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok = keypath.Delete(m, p)
+
+	return ok, nil
+}
 
-	for _, k := range keys[:n] {
-		if it, ok = it[k].(map[string]any); !ok {
-			return false
+func Mask(m map[string]any) error {
+	v, err := Get[[]any](m, "mask")
+	if err != nil {
+		return fmt.Errorf("mask keys: %w", err)
+	}
+
+	for _, v := range v {
+		matches, err := Lookup(m, fmt.Sprint(v))
+		if err != nil {
+			return fmt.Errorf("mask keys: %w", err)
+		}
+
+		for _, match := range matches {
+			if _, err := Set(m, match.Path.String(), "***"); err != nil {
+				return fmt.Errorf("mask keys: %w", err)
+			}
 		}
 	}
 
-	if _, ok = it[keys[n]]; ok {
-		delete(it, keys[n])
-		return true
+	return nil
+}
+
+func Exclude(m map[string]any) error {
+	v, err := Get[[]any](m, "exclude")
+	if err != nil {
+		return fmt.Errorf("excluding keys: %w", err)
+	}
+
+	for _, v := range v {
+		if _, err := Del(m, fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("excluding keys: %w", err)
+		}
 	}
 
-	return false
+	return nil
 }
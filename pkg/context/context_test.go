@@ -1,9 +1,12 @@
 package context
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
+	"rafal.dev/reflow/pkg/lazy"
+
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -80,8 +83,8 @@ func TestGetSetDel(t *testing.T) {
 		t.Run("", func(t *testing.T) {
 			switch cas.op {
 			case set:
-				if ok := Set(m, cas.k, cas.v); ok != cas.ok {
-					t.Errorf("Set(): got %t, want %t", ok, cas.ok)
+				if ok, err := Set(m, cas.k, cas.v); err != nil || ok != cas.ok {
+					t.Errorf("Set(): got %t, %v, want %t", ok, err, cas.ok)
 				}
 			case get:
 				switch v, err := Get[string](m, cas.k); {
@@ -93,8 +96,8 @@ func TestGetSetDel(t *testing.T) {
 					}
 				}
 			case del:
-				if ok := Del(m, cas.k); ok != cas.ok {
-					t.Errorf("Del(): got %t, want %t", ok, cas.ok)
+				if ok, err := Del(m, cas.k); err != nil || ok != cas.ok {
+					t.Errorf("Del(): got %t, %v, want %t", ok, err, cas.ok)
 				}
 			default:
 				panic(fmt.Errorf("%d: unrecognized op: %d", i, cas.op))
@@ -102,3 +105,71 @@ func TestGetSetDel(t *testing.T) {
 		})
 	}
 }
+
+func TestSetError(t *testing.T) {
+	m := map[string]any{"list": []any{"a", "b"}}
+
+	for _, path := range []string{`a."b`, "list.-5", "list[5]", "list.name"} {
+		if _, err := Set(m, path, "x"); err == nil {
+			t.Errorf("Set(%q): want error", path)
+		}
+	}
+
+	if _, err := Del(m, `a."b`); err == nil {
+		t.Errorf("Del(): want error")
+	}
+
+	if want := map[string]any{"list": []any{"a", "b"}}; !cmp.Equal(m, want) {
+		t.Errorf("got != want:\n%s", cmp.Diff(m, want))
+	}
+}
+
+func TestGetLazy(t *testing.T) {
+	var (
+		calls   int
+		errBoom = errors.New("boom")
+	)
+
+	m := map[string]any{
+		"reflow": lazy.New(func() (any, error) {
+			calls++
+
+			return map[string]any{
+				"sha":    "abc",
+				"labels": []any{lazy.New(func() (any, error) { return "bug", nil })},
+			}, nil
+		}),
+		"failed": lazy.New(func() (any, error) { return nil, errBoom }),
+	}
+
+	cases := []struct {
+		path string
+		want any
+	}{
+		{"reflow.sha", "abc"},
+		{"reflow.labels[0]", "bug"},
+		{"reflow.labels[*]", []any{"bug"}},
+		{"reflow", map[string]any{"sha": "abc", "labels": []any{"bug"}}},
+	}
+
+	for _, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			got, err := Get[any](m, cas.path)
+			if err != nil {
+				t.Fatalf("Get()=%s", err)
+			}
+
+			if !cmp.Equal(got, cas.want) {
+				t.Fatalf("got != want:\n%s", cmp.Diff(got, cas.want))
+			}
+		})
+	}
+
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+
+	if _, err := Get[any](m, "failed.key"); !errors.Is(err, errBoom) {
+		t.Fatalf("got %v, want %v", err, errBoom)
+	}
+}
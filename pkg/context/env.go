@@ -0,0 +1,163 @@
+package context
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"rafal.dev/reflow/pkg/codec"
+	"rafal.dev/reflow/pkg/debug"
+)
+
+// EnvBuilder maps environment variables with the Prefix, REFLOW_ by default,
+// into the context, with double underscores separating nested keys,
+// e.g. REFLOW_VALUES__IMAGE__TAG=v1 sets values.image.tag to "v1".
+// Values that are valid JSON numbers, booleans, objects or arrays
+// are decoded, other values are set as strings.
+//
+// If GitHub is true and the context has no github key, it is synthesized
+// from the GITHUB_* variables, with the event read from GITHUB_EVENT_PATH,
+// as found in GitHub Actions runners.
+type EnvBuilder struct {
+	Prefix  string
+	GitHub  bool
+	Environ func() []string
+}
+
+var _ Builder = (*EnvBuilder)(nil)
+
+// reservedEnv are variables configuring reflow itself,
+// which are never mapped into the context.
+var reservedEnv = map[string]bool{
+	"REFLOW_DEBUG":    true,
+	"REFLOW_HOME":     true,
+	"REFLOW_KEY":      true,
+	"REFLOW_KEY_FILE": true,
+	"REFLOW_STRICT":   true,
+}
+
+func (eb *EnvBuilder) Build(ctx context.Context, m map[string]any) error {
+	prefix := eb.prefix()
+
+	for _, kv := range eb.environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || reservedEnv[k] || !strings.HasPrefix(k, prefix) || len(k) == len(prefix) {
+			continue
+		}
+
+		var keys []string
+
+		for _, s := range strings.Split(strings.ToLower(k[len(prefix):]), "__") {
+			if s == "" {
+				keys = nil
+				break
+			}
+
+			keys = append(keys, s)
+		}
+
+		if keys == nil {
+			debug.Logf(ctx, "%T: skipping invalid variable name %q", eb, k)
+			continue
+		}
+
+		path := joinKeys(keys)
+		val := inferValue(v)
+
+		if _, err := Set(m, path, val); err != nil {
+			return fmt.Errorf("env builder: %w", err)
+		}
+
+		record(ctx, path, val, Origin{Builder: fmt.Sprintf("%T", eb), Source: "$" + k})
+	}
+
+	if _, ok := m["github"]; eb.GitHub && !ok {
+		if err := eb.buildGitHub(ctx, m); err != nil {
+			return fmt.Errorf("env builder: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (eb *EnvBuilder) buildGitHub(ctx context.Context, m map[string]any) error {
+	github := make(map[string]any)
+
+	for _, kv := range eb.environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(k, "GITHUB_") {
+			continue
+		}
+
+		switch k {
+		case "GITHUB_TOKEN":
+			continue
+		case "GITHUB_EVENT_PATH":
+			p, err := os.ReadFile(v)
+			if err != nil {
+				return fmt.Errorf("reading event: %w", err)
+			}
+
+			var event any
+
+			if err := unmarshalYAML(p, &event); err != nil {
+				return fmt.Errorf("reading event %q: %w", v, err)
+			}
+
+			github["event"] = event
+			github["event_path"] = v
+		default:
+			github[strings.ToLower(strings.TrimPrefix(k, "GITHUB_"))] = v
+		}
+	}
+
+	if _, ok := github["event_name"]; !ok {
+		return nil
+	}
+
+	m["github"] = github
+
+	record(ctx, "github", github, Origin{Builder: fmt.Sprintf("%T", eb), Source: "$GITHUB_*"})
+
+	return nil
+}
+
+func (eb *EnvBuilder) prefix() string {
+	if eb.Prefix != "" {
+		return eb.Prefix
+	}
+
+	return "REFLOW_"
+}
+
+func (eb *EnvBuilder) environ() []string {
+	if eb.Environ != nil {
+		return eb.Environ()
+	}
+
+	return os.Environ()
+}
+
+func inferValue(s string) any {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+
+	var v any
+
+	if err := dec.Decode(&v); err != nil || dec.More() || v == nil {
+		return s
+	}
+
+	if _, ok := v.(string); ok {
+		return s
+	}
+
+	if v, err := codec.Generic(v); err == nil {
+		return v
+	}
+
+	return s
+}
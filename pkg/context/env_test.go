@@ -0,0 +1,101 @@
+package context
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEnvBuilder(t *testing.T) {
+	event := filepath.Join(t.TempDir(), "event.json")
+
+	if err := os.WriteFile(event, []byte(`{"pull_request": {"number": 42}}`), 0644); err != nil {
+		t.Fatalf("WriteFile()=%+v", err)
+	}
+
+	env := []string{
+		"REFLOW_VALUES__IMAGE__TAG=v1.0.0",
+		"REFLOW_VALUES__REPLICAS=3",
+		"REFLOW_VALUES__DEBUG=true",
+		"REFLOW_VALUES__RATIO=0.5",
+		"REFLOW_VALUES__PORTS=[80, 443]",
+		"REFLOW_VALUES__ZIP=007",
+		"REFLOW_VALUES__NODE_SELECTOR={\"zone\": \"a\"}",
+		"REFLOW_HOME=/home/reflow",
+		"REFLOW_KEY=secret",
+		"GITHUB_EVENT_NAME=pull_request",
+		"GITHUB_REPOSITORY=rjeczalik/reflow",
+		"GITHUB_SHA=abc",
+		"GITHUB_RUN_ID=123",
+		"GITHUB_TOKEN=secret",
+		"GITHUB_EVENT_PATH=" + event,
+		"HOME=/root",
+	}
+
+	m := map[string]any{
+		"values": map[string]any{"replicas": 1, "env": "dev"},
+	}
+
+	b := &EnvBuilder{
+		GitHub:  true,
+		Environ: func() []string { return env },
+	}
+
+	if err := b.Build(context.Background(), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	want := map[string]any{
+		"values": map[string]any{
+			"env":           "dev",
+			"image":         map[string]any{"tag": "v1.0.0"},
+			"replicas":      3,
+			"debug":         true,
+			"ratio":         0.5,
+			"ports":         []any{80, 443},
+			"zip":           "007",
+			"node_selector": map[string]any{"zone": "a"},
+		},
+		"github": map[string]any{
+			"event_name": "pull_request",
+			"repository": "rjeczalik/reflow",
+			"sha":        "abc",
+			"run_id":     "123",
+			"event_path": event,
+			"event": map[string]any{
+				"pull_request": map[string]any{"number": 42},
+			},
+		},
+	}
+
+	if !cmp.Equal(m, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(m, want))
+	}
+
+	m = map[string]any{"github": map[string]any{"event_name": "push"}}
+
+	if err := b.Build(context.Background(), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	if got, _ := Get[string](m, "github.event_name"); got != "push" {
+		t.Fatalf("got %q, want existing github key to be kept", got)
+	}
+
+	b.Environ = func() []string {
+		return []string{"REFLOW_VALUES____TAG=x", "REFLOW_VALUES__=x", "REFLOW_VALUES__TAG=v1"}
+	}
+
+	m = make(map[string]any)
+
+	if err := b.Build(context.Background(), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	if want := map[string]any{"values": map[string]any{"tag": "v1"}}; !cmp.Equal(m, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(m, want))
+	}
+}
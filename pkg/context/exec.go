@@ -0,0 +1,251 @@
+package context
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"rafal.dev/reflow/pkg/codec"
+	"rafal.dev/reflow/pkg/debug"
+	"rafal.dev/reflow/pkg/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Command describes an external command, which output is stored
+// in the context under the key it is configured with.
+type Command struct {
+	// Command is the list of arguments, run without a shell.
+	Command any               `yaml:"command"`
+	Format  string            `yaml:"format"`
+	Timeout time.Duration     `yaml:"timeout"`
+	Dir     string            `yaml:"dir"`
+	Env     map[string]string `yaml:"env"`
+	// Optional commands that fail leave the key unset.
+	Optional bool `yaml:"optional"`
+}
+
+// ExecBuilder runs commands configured under the Key in the context,
+// e.g. with the following $REFLOW_HOME/context/exec.yaml:
+//
+//	git.describe:
+//	  command: [git, describe, --tags, "{{ .github.sha }}"]
+//	kube.pods:
+//	  command: [kubectl, get, pods, -o, json]
+//	  format: json
+//	  timeout: 10s
+//
+// Each argument is a template executed against the context built so far
+// on its own, so a templated value always ends up as a single argument.
+// Commands are not run with a shell; scripts needing one should take the
+// templated values as positional parameters instead of embedding them,
+// e.g. [sh, -c, 'echo "$1"', sh, "{{ .values.tag }}"].
+// The output is decoded with the given format, or stored as a trimmed
+// string for the text format, which is the default. Commands are run
+// sequentially in lexical order of their keys.
+type ExecBuilder struct {
+	Key     string
+	Timeout time.Duration
+
+	// Template options to execute the arguments with, template.Default if nil.
+	Template *template.Options
+}
+
+var _ Builder = (*ExecBuilder)(nil)
+
+func (eb *ExecBuilder) Build(ctx context.Context, m map[string]any) error {
+	cfg, err := Get[map[string]any](m, eb.key())
+	var ke *KeyError
+	if errors.As(err, &ke) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("exec builder: %w", err)
+	}
+
+	cmds := make(map[string]Command, len(cfg))
+
+	if err := decodeConfig(cfg, &cmds); err != nil {
+		return fmt.Errorf("exec builder: %w", err)
+	}
+
+	keys := make([]string, 0, len(cmds))
+
+	for k := range cmds {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		cmd := cmds[k]
+
+		if skipConv(ctx) {
+			debug.Logf(ctx, "%T: skipping %q", eb, k)
+
+			if _, err := Set(m, k, template.Unknown); err != nil {
+				return fmt.Errorf("exec builder %q: %w", k, err)
+			}
+
+			continue
+		}
+
+		args, err := cmd.args(eb.template(ctx), m)
+		if err != nil {
+			return fmt.Errorf("exec builder %q: %w", k, err)
+		}
+
+		v, err := eb.run(ctx, cmd, args)
+		if err != nil {
+			if cmd.Optional {
+				debug.Logf(ctx, "%T: ignoring %q: %s", eb, k, err)
+				continue
+			}
+
+			return fmt.Errorf("exec builder %q: %w", k, err)
+		}
+
+		if _, err := Set(m, k, v); err != nil {
+			return fmt.Errorf("exec builder %q: %w", k, err)
+		}
+
+		record(ctx, k, v, Origin{
+			Builder: fmt.Sprintf("%T", eb),
+			Source:  strings.Join(args, " "),
+		})
+	}
+
+	return nil
+}
+
+func (eb *ExecBuilder) run(ctx context.Context, cmd Command, args []string) (any, error) {
+	timeout := cmd.Timeout
+	if timeout == 0 {
+		timeout = eb.timeout()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		c              = exec.CommandContext(ctx, args[0], args[1:]...)
+		stdout, stderr bytes.Buffer
+	)
+
+	c.Dir = cmd.Dir
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+
+	if len(cmd.Env) != 0 {
+		c.Env = os.Environ()
+
+		for k, v := range cmd.Env {
+			c.Env = append(c.Env, k+"="+v)
+		}
+	}
+
+	debug.Logf(ctx, "%T: running %q", eb, args)
+
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return nil, fmt.Errorf("%q: %w: %s", args[0], err, s)
+		}
+
+		return nil, fmt.Errorf("%q: %w", args[0], err)
+	}
+
+	switch format := strings.ToLower(cmd.Format); format {
+	case "", "text":
+		return strings.TrimSpace(stdout.String()), nil
+	case "lines":
+		return lines(stdout.String()), nil
+	default:
+		var v any
+
+		if err := codec.Unmarshal(stdout.Bytes(), format, &v); err != nil {
+			return nil, fmt.Errorf("%q: decoding %s output: %w", args[0], format, err)
+		}
+
+		return v, nil
+	}
+}
+
+func (eb *ExecBuilder) key() string {
+	if eb.Key != "" {
+		return eb.Key
+	}
+
+	return "exec"
+}
+
+func (eb *ExecBuilder) template(ctx context.Context) template.Options {
+	o := template.Default
+	if eb.Template != nil {
+		o = *eb.Template
+	}
+	o.Context = ctx
+
+	return o
+}
+
+func (eb *ExecBuilder) timeout() time.Duration {
+	if eb.Timeout != 0 {
+		return eb.Timeout
+	}
+
+	return 30 * time.Second
+}
+
+func (cmd Command) args(o template.Options, m map[string]any) ([]string, error) {
+	var args []string
+
+	switch v := cmd.Command.(type) {
+	case string:
+		return nil, errors.New("invalid command: must be a list of arguments")
+	case []any:
+		for _, v := range v {
+			args = append(args, fmt.Sprint(v))
+		}
+	default:
+		return nil, fmt.Errorf("invalid command: %T", v)
+	}
+
+	if len(args) == 0 || args[0] == "" {
+		return nil, errors.New("empty command")
+	}
+
+	for i, arg := range args {
+		p, err := o.Execute(arg, m)
+		if err != nil {
+			return nil, fmt.Errorf("templating argument %d: %w", i, err)
+		}
+
+		args[i] = string(p)
+	}
+
+	return args, nil
+}
+
+// decodeConfig decodes a config value from the context into v.
+func decodeConfig(cfg, v any) error {
+	p, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(p, v); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	return nil
+}
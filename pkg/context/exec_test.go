@@ -0,0 +1,126 @@
+package context
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rafal.dev/reflow/pkg/template"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExecBuilder(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	m := map[string]any{
+		"values": map[string]any{"tag": "v1.0.0", "name": "a; echo injected"},
+		"exec": map[string]any{
+			"git.describe": map[string]any{
+				"command": []any{"echo", "{{ .values.tag }}-1-gabc"},
+			},
+			"kube.pods": map[string]any{
+				"command": []any{"echo", `{"items": [{"name": "{{ .values.name }}"}]}`},
+				"format":  "json",
+			},
+			"files": map[string]any{
+				"command": []any{"printf", "a\\n\\nb\\n"},
+				"format":  "lines",
+			},
+			"vault.token": map[string]any{
+				"command": []any{"sh", "-c", `echo "$TOKEN" "$1"`, "sh", "{{ .values.name }}"},
+				"env":     map[string]any{"TOKEN": "secret"},
+			},
+			"missing": map[string]any{
+				"command":  []any{"false"},
+				"optional": true,
+			},
+		},
+	}
+
+	if err := (&ExecBuilder{}).Build(context.Background(), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	cases := map[string]any{
+		"git.describe": "v1.0.0-1-gabc",
+		"kube.pods":    map[string]any{"items": []any{map[string]any{"name": "a; echo injected"}}},
+		"files":        []any{"a", "b"},
+		"vault.token":  "secret a; echo injected",
+	}
+
+	for path, want := range cases {
+		got, err := Get[any](m, path)
+		if err != nil {
+			t.Fatalf("%s: Get()=%+v", path, err)
+		}
+
+		if !cmp.Equal(got, want) {
+			t.Errorf("%s: got != want:\n%s", path, cmp.Diff(got, want))
+		}
+	}
+
+	if _, err := Get[any](m, "missing"); err == nil {
+		t.Errorf("missing: want error")
+	}
+}
+
+func TestExecBuilderError(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	cases := map[string]map[string]any{
+		"exit status":    {"command": []any{"sh", "-c", "echo oops >&2; exit 3"}},
+		"deadline":       {"command": []any{"sleep", "5"}, "timeout": "50ms"},
+		"decoding json":  {"command": []any{"echo", "{"}, "format": "json"},
+		"templating":     {"command": []any{"echo", "{{ .values"}},
+		"must be a list": {"command": "echo {{ .values }}"},
+	}
+
+	for want, cfg := range cases {
+		m := map[string]any{"exec": map[string]any{"out": cfg}}
+
+		err := (&ExecBuilder{Timeout: time.Second}).Build(context.Background(), m)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Build()=%v, want error containing %q", err, want)
+		}
+	}
+}
+
+func TestExecBuilderTemplate(t *testing.T) {
+	o := template.Default
+	o.Strict = true
+
+	m := map[string]any{"exec": map[string]any{"out": map[string]any{"command": []any{"echo", "{{ .values.missing }}"}}}}
+
+	err := (&ExecBuilder{Template: &o}).Build(context.Background(), m)
+	if err == nil || !strings.Contains(err.Error(), "templating argument 1") {
+		t.Fatalf("Build()=%v, want templating error", err)
+	}
+}
+
+func TestExecBuilderWithoutConv(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "ran")
+		m    = map[string]any{"exec": map[string]any{"out": map[string]any{"command": []any{"touch", file}}}}
+	)
+
+	if err := (&ExecBuilder{}).Build(WithoutConv(context.Background()), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	if got, err := Get[any](m, "out"); err != nil || got != template.Unknown {
+		t.Fatalf("Get()=%v, %+v, want template.Unknown", got, err)
+	}
+
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("Stat()=%v, want the command not to run", err)
+	}
+}
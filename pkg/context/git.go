@@ -0,0 +1,202 @@
+package context
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"rafal.dev/reflow/pkg/debug"
+)
+
+// GitBuilder populates the Key, git by default, with metadata of the
+// repository checked out in the Dir:
+//
+//	git.root       - top-level directory of the working tree
+//	git.head       - HEAD commit SHA
+//	git.branch     - current branch, empty for detached HEAD
+//	git.tags       - tags pointing at HEAD
+//	git.describe   - output of git describe --tags --always
+//	git.author     - name and email of the HEAD commit author
+//	git.message    - HEAD commit message
+//	git.dirty      - whether the working tree has uncommitted changes
+//	git.remote     - URL of the origin remote
+//	git.owner      - GitHub owner parsed from git.remote
+//	git.repo       - GitHub repository parsed from git.remote
+//	git.base       - base ref the changed files are compared against
+//	git.changed    - files changed between git.base and HEAD
+//
+// The base ref is the Base, or git.base if already set in the context,
+// or origin/<github.base_ref> for pull requests.
+//
+// If the Dir is not a git repository or git is not installed,
+// the builder does nothing.
+type GitBuilder struct {
+	Dir  string
+	Key  string
+	Base string
+}
+
+var _ Builder = (*GitBuilder)(nil)
+
+func (gb *GitBuilder) Build(ctx context.Context, m map[string]any) error {
+	root, err := gb.git(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		debug.Logf(ctx, "%T: skipping: %s", gb, err)
+		return nil
+	}
+
+	head, err := gb.git(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		debug.Logf(ctx, "%T: skipping: %s", gb, err)
+		return nil
+	}
+
+	// The first error of set is returned once all the values are set.
+	var serr error
+
+	set := func(key string, v any, source string) {
+		path := gb.key() + "." + key
+
+		if _, err := Set(m, path, v); err != nil {
+			if serr == nil {
+				serr = err
+			}
+
+			return
+		}
+
+		record(ctx, path, v, Origin{Builder: fmt.Sprintf("%T", gb), Source: source})
+	}
+
+	set("root", root, "git rev-parse --show-toplevel")
+	set("head", head, "git rev-parse HEAD")
+
+	branch, _ := gb.git(ctx, "symbolic-ref", "--quiet", "--short", "HEAD")
+	set("branch", branch, "git symbolic-ref --short HEAD")
+
+	tags, err := gb.git(ctx, "tag", "--points-at", "HEAD", "--sort=-version:refname")
+	if err != nil {
+		return fmt.Errorf("git builder: %w", err)
+	}
+	set("tags", lines(tags), "git tag --points-at HEAD")
+
+	describe, err := gb.git(ctx, "describe", "--tags", "--always")
+	if err != nil {
+		return fmt.Errorf("git builder: %w", err)
+	}
+	set("describe", describe, "git describe --tags --always")
+
+	log, err := gb.git(ctx, "log", "-1", "--format=%an%x00%ae%x00%B")
+	if err != nil {
+		return fmt.Errorf("git builder: %w", err)
+	}
+
+	if v := strings.SplitN(log, "\x00", 3); len(v) == 3 {
+		set("author", map[string]any{"name": v[0], "email": v[1]}, "git log -1")
+		set("message", strings.TrimSpace(v[2]), "git log -1")
+	}
+
+	status, err := gb.git(ctx, "status", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("git builder: %w", err)
+	}
+	set("dirty", status != "", "git status --porcelain")
+
+	if remote, err := gb.git(ctx, "remote", "get-url", "origin"); err == nil {
+		set("remote", remote, "git remote get-url origin")
+
+		if owner, repo, ok := parseRemote(remote); ok {
+			set("owner", owner, "git remote get-url origin")
+			set("repo", repo, "git remote get-url origin")
+		}
+	}
+
+	if base := gb.base(m); base != "" {
+		// The base may not be fetched, e.g. in shallow clones.
+		if changed, err := gb.git(ctx, "diff", "--name-only", base+"...HEAD"); err == nil {
+			set("base", base, "git diff --name-only "+base+"...HEAD")
+			set("changed", lines(changed), "git diff --name-only "+base+"...HEAD")
+		} else {
+			debug.Logf(ctx, "%T: ignoring changes against %q: %s", gb, base, err)
+		}
+	}
+
+	if serr != nil {
+		return fmt.Errorf("git builder: %w", serr)
+	}
+
+	return nil
+}
+
+func (gb *GitBuilder) base(m map[string]any) string {
+	if gb.Base != "" {
+		return gb.Base
+	}
+
+	if s, err := Get[string](m, gb.key()+".base"); err == nil && s != "" {
+		return s
+	}
+
+	if s, err := Get[string](m, "github.base_ref"); err == nil && s != "" {
+		return "origin/" + s
+	}
+
+	return ""
+}
+
+func (gb *GitBuilder) key() string {
+	if gb.Key != "" {
+		return gb.Key
+	}
+
+	return "git"
+}
+
+func (gb *GitBuilder) git(ctx context.Context, args ...string) (string, error) {
+	var (
+		cmd            = exec.CommandContext(ctx, "git", args...)
+		stdout, stderr bytes.Buffer
+	)
+
+	cmd.Dir = gb.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) && stderr.Len() != 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+var remoteRe = regexp.MustCompile(`github\.com[:/]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+
+func parseRemote(remote string) (owner, repo string, ok bool) {
+	v := remoteRe.FindStringSubmatch(remote)
+	if v == nil {
+		return "", "", false
+	}
+
+	return v[1], v[2], true
+}
+
+func lines(s string) []any {
+	l := make([]any, 0)
+
+	for _, s := range strings.Split(s, "\n") {
+		if s = strings.TrimSpace(s); s != "" {
+			l = append(l, s)
+		}
+	}
+
+	return l
+}
@@ -0,0 +1,120 @@
+package context
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGitBuilder(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+
+	git := func(args ...string) {
+		t.Helper()
+
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Jane", "-c", "user.email=jane@example.com", "-c", "tag.gpgSign=false", "-c", "commit.gpgSign=false"}, args...)...)
+		cmd.Dir = dir
+
+		if p, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %+v: %s", args, err, p)
+		}
+	}
+
+	write := func(file, data string) {
+		t.Helper()
+
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(data), 0644); err != nil {
+			t.Fatalf("WriteFile()=%+v", err)
+		}
+	}
+
+	git("init", "-q", "-b", "main")
+	git("remote", "add", "origin", "git@github.com:rjeczalik/reflow.git")
+	write("a.txt", "a")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	git("tag", "v1.0.0")
+	git("checkout", "-q", "-b", "feature")
+	write("b.txt", "b")
+	git("add", ".")
+	git("commit", "-q", "-m", "add b\n\nbody")
+	git("tag", "v1.1.0-rc.1")
+	write("a.txt", "dirty")
+
+	m := map[string]any{
+		"git": map[string]any{"base": "main"},
+	}
+
+	b := SeqBuilder{
+		&GitBuilder{Dir: dir},
+		&ReflowBuilder{},
+	}
+
+	if err := b.Build(context.Background(), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	head, err := Get[string](m, "git.head")
+	if err != nil || len(head) != 40 {
+		t.Fatalf("git.head=%q, %+v", head, err)
+	}
+
+	cases := map[string]any{
+		"git.branch":       "feature",
+		"git.tags":         []any{"v1.1.0-rc.1"},
+		"git.describe":     "v1.1.0-rc.1",
+		"git.author.name":  "Jane",
+		"git.author.email": "jane@example.com",
+		"git.message":      "add b\n\nbody",
+		"git.dirty":        true,
+		"git.owner":        "rjeczalik",
+		"git.repo":         "reflow",
+		"git.changed":      []any{"b.txt"},
+		"reflow.owner":     "rjeczalik",
+		"reflow.repo":      "reflow",
+		"reflow.ref":       "refs/heads/feature",
+		"reflow.sha":       head,
+	}
+
+	for path, want := range cases {
+		got, err := Get[any](m, path)
+		if err != nil {
+			t.Errorf("%s: Get()=%+v", path, err)
+			continue
+		}
+
+		if !cmp.Equal(got, want) {
+			t.Errorf("%s: got != want:\n%s", path, cmp.Diff(got, want))
+		}
+	}
+
+	m = make(map[string]any)
+
+	if err := (&GitBuilder{Dir: dir, Base: "origin/missing"}).Build(context.Background(), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	if _, err := Get[any](m, "git.changed"); err == nil {
+		t.Fatal("git.changed: want unset for a missing base")
+	}
+}
+
+func TestGitBuilderNoRepo(t *testing.T) {
+	m := make(map[string]any)
+
+	if err := (&GitBuilder{Dir: t.TempDir()}).Build(context.Background(), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	if len(m) != 0 {
+		t.Fatalf("got %v, want empty context", m)
+	}
+}
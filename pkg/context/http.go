@@ -0,0 +1,368 @@
+package context
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"rafal.dev/reflow/pkg/codec"
+	"rafal.dev/reflow/pkg/debug"
+	"rafal.dev/reflow/pkg/template"
+)
+
+// Endpoint describes a remote document, which decoded body is stored
+// in the context under the key it is configured with.
+type Endpoint struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Format  string            `yaml:"format"`
+	TTL     time.Duration     `yaml:"ttl"`
+	// Optional endpoints that fail leave the key unset.
+	Optional bool `yaml:"optional"`
+}
+
+// HTTPBuilder fetches endpoints configured under the Key in the context,
+// e.g. with the following $REFLOW_HOME/context/http.yaml:
+//
+//	env.meta:
+//	  url: https://meta.example.com/envs/{{ .values.env }}.json
+//	  headers:
+//	    Authorization: Bearer {{ .secrets.meta_token }}
+//	  ttl: 10m
+//
+// The URL and header values are templates executed against the context
+// built so far, so the secrets.meta_token above can come e.g. from the
+// REFLOW_SECRETS__META_TOKEN variable mapped by the EnvBuilder. Header
+// values are always executed in strict mode, so a missing secret fails
+// the build instead of being sent as "<no value>". The body
+// is decoded with the given format, or the one inferred from the
+// Content-Type or the URL extension, YAML otherwise. Bodies larger than
+// MaxBody, 10MiB by default, are rejected.
+//
+// Responses are cached in the CacheDir: a cached body is reused without
+// a request until its TTL expires, and revalidated with ETag and
+// Last-Modified afterwards. Headers are never written to the cache.
+type HTTPBuilder struct {
+	Key      string
+	Client   *http.Client
+	CacheDir string
+	MaxBody  int64
+
+	// Template options to execute the URL and headers with, template.Default if nil.
+	Template *template.Options
+}
+
+var _ Builder = (*HTTPBuilder)(nil)
+
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Body         []byte    `json:"body"`
+}
+
+func (hb *HTTPBuilder) Build(ctx context.Context, m map[string]any) error {
+	cfg, err := Get[map[string]any](m, hb.key())
+	var ke *KeyError
+	if errors.As(err, &ke) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("http builder: %w", err)
+	}
+
+	endpoints := make(map[string]Endpoint, len(cfg))
+
+	if err := decodeConfig(cfg, &endpoints); err != nil {
+		return fmt.Errorf("http builder: %w", err)
+	}
+
+	keys := make([]string, 0, len(endpoints))
+
+	for k := range endpoints {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		e := endpoints[k]
+
+		if skipConv(ctx) {
+			debug.Logf(ctx, "%T: skipping %q", hb, k)
+
+			if _, err := Set(m, k, template.Unknown); err != nil {
+				return fmt.Errorf("http builder %q: %w", k, err)
+			}
+
+			continue
+		}
+
+		req, err := e.request(ctx, hb.template(ctx), m)
+		if err != nil {
+			return fmt.Errorf("http builder %q: %w", k, err)
+		}
+
+		v, err := hb.fetch(ctx, e, req)
+		if err != nil {
+			if e.Optional {
+				debug.Logf(ctx, "%T: ignoring %q: %s", hb, k, err)
+				continue
+			}
+
+			return fmt.Errorf("http builder %q: %w", k, err)
+		}
+
+		if _, err := Set(m, k, v); err != nil {
+			return fmt.Errorf("http builder %q: %w", k, err)
+		}
+
+		record(ctx, k, v, Origin{
+			Builder: fmt.Sprintf("%T", hb),
+			Source:  "GET " + req.URL.Redacted(),
+		})
+	}
+
+	return nil
+}
+
+func (hb *HTTPBuilder) fetch(ctx context.Context, e Endpoint, req *http.Request) (any, error) {
+	var (
+		file  = hb.cacheFile(req)
+		entry = hb.readCache(ctx, file)
+	)
+
+	switch {
+	case entry != nil && e.TTL > 0 && time.Since(entry.Fetched) < e.TTL:
+		debug.Logf(ctx, "%T: using cached %q", hb, entry.URL)
+
+		return e.decode(entry)
+	case entry != nil:
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := hb.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		debug.Logf(ctx, "%T: %q not modified", hb, entry.URL)
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, hb.maxBody()+1))
+		if err != nil {
+			return nil, fmt.Errorf("reading response: %w", err)
+		}
+
+		if int64(len(body)) > hb.maxBody() {
+			return nil, fmt.Errorf("GET %s: body exceeds %d bytes", req.URL.Redacted(), hb.maxBody())
+		}
+
+		entry = &cacheEntry{
+			URL:          req.URL.Redacted(),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			ContentType:  resp.Header.Get("Content-Type"),
+			Body:         body,
+		}
+	default:
+		p, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+		return nil, fmt.Errorf("GET %s: %s: %s", req.URL.Redacted(), resp.Status, strings.TrimSpace(string(p)))
+	}
+
+	entry.Fetched = time.Now()
+
+	hb.writeCache(ctx, file, entry)
+
+	return e.decode(entry)
+}
+
+func (hb *HTTPBuilder) cacheFile(req *http.Request) string {
+	if hb.CacheDir == "" {
+		return ""
+	}
+
+	var (
+		h    = sha256.New()
+		keys = make([]string, 0, len(req.Header))
+	)
+
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	fmt.Fprintln(h, req.URL.String())
+
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s: %s\n", k, strings.Join(req.Header[k], ","))
+	}
+
+	return filepath.Join(hb.CacheDir, "http", hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+func (hb *HTTPBuilder) readCache(ctx context.Context, file string) *cacheEntry {
+	if file == "" {
+		return nil
+	}
+
+	p, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	var entry cacheEntry
+
+	if err := json.Unmarshal(p, &entry); err != nil {
+		debug.Logf(ctx, "%T: ignoring invalid cache %q: %s", hb, file, err)
+		return nil
+	}
+
+	return &entry
+}
+
+func (hb *HTTPBuilder) writeCache(ctx context.Context, file string, entry *cacheEntry) {
+	if file == "" {
+		return
+	}
+
+	p, err := json.Marshal(entry)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(file), 0700); err == nil {
+			err = os.WriteFile(file, p, 0600)
+		}
+	}
+
+	if err != nil {
+		debug.Logf(ctx, "%T: unable to write cache %q: %s", hb, file, err)
+	}
+}
+
+func (hb *HTTPBuilder) client() *http.Client {
+	if hb.Client != nil {
+		return hb.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (hb *HTTPBuilder) key() string {
+	if hb.Key != "" {
+		return hb.Key
+	}
+
+	return "http"
+}
+
+func (hb *HTTPBuilder) template(ctx context.Context) template.Options {
+	o := template.Default
+	if hb.Template != nil {
+		o = *hb.Template
+	}
+	o.Context = ctx
+
+	return o
+}
+
+func (hb *HTTPBuilder) maxBody() int64 {
+	if hb.MaxBody != 0 {
+		return hb.MaxBody
+	}
+
+	return 10 * 1024 * 1024
+}
+
+func (e Endpoint) request(ctx context.Context, o template.Options, m map[string]any) (*http.Request, error) {
+	p, err := o.Execute(e.URL, m)
+	if err != nil {
+		return nil, fmt.Errorf("templating url: %w", err)
+	}
+
+	u, err := url.Parse(strings.TrimSpace(string(p)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid url %q: unsupported scheme", u.Redacted())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Strict = true
+
+	for k, v := range e.Headers {
+		p, err := o.Execute(v, m)
+		if err != nil {
+			return nil, fmt.Errorf("templating header %q: %w", k, err)
+		}
+
+		req.Header.Set(k, string(p))
+	}
+
+	return req, nil
+}
+
+func (e Endpoint) decode(entry *cacheEntry) (any, error) {
+	format := e.Format
+
+	if format == "" {
+		if typ, _, err := mime.ParseMediaType(entry.ContentType); err == nil {
+			typ = typ[strings.LastIndexAny(typ, "/+")+1:]
+
+			if _, ok := codec.Lookup(typ); ok {
+				format = typ
+			}
+		}
+	}
+
+	if format == "" {
+		if u, err := url.Parse(entry.URL); err == nil {
+			if ext := path.Ext(u.Path); ext != "" {
+				if _, ok := codec.Lookup(ext); ok {
+					format = ext
+				}
+			}
+		}
+	}
+
+	if format == "" {
+		format = "yaml"
+	}
+
+	var v any
+
+	if err := codec.Unmarshal(entry.Body, format, &v); err != nil {
+		return nil, fmt.Errorf("decoding %s body: %w", strings.TrimPrefix(format, "."), err)
+	}
+
+	return v, nil
+}
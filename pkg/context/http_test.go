@@ -0,0 +1,152 @@
+package context
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPBuilder(t *testing.T) {
+	var requests, fetches int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		atomic.AddInt32(&fetches, 1)
+
+		switch r.URL.Path {
+		case "/envs/prod.json":
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"region": "eu-west-1", "replicas": 3}`))
+		case "/envs/prod.toml":
+			w.Write([]byte("region = \"eu-west-1\"\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var (
+		dir = t.TempDir()
+		hb  = &HTTPBuilder{CacheDir: dir}
+	)
+
+	build := func(cfg map[string]any) (map[string]any, error) {
+		m := map[string]any{
+			"values":  map[string]any{"env": "prod"},
+			"secrets": map[string]any{"token": "s3cr3t"},
+			"http":    cfg,
+		}
+
+		return m, hb.Build(context.Background(), m)
+	}
+
+	endpoint := func(ext string, ttl string) map[string]any {
+		e := map[string]any{
+			"url":     srv.URL + "/envs/{{ .values.env }}." + ext,
+			"headers": map[string]any{"Authorization": "Bearer {{ .secrets.token }}"},
+		}
+
+		if ttl != "" {
+			e["ttl"] = ttl
+		}
+
+		return e
+	}
+
+	cases := []struct {
+		cfg      map[string]any
+		path     string
+		want     any
+		requests int32
+		fetches  int32
+	}{
+		0: {map[string]any{"env.meta": endpoint("json", "0s")}, "env.meta.replicas", 3, 1, 1},
+		1: {map[string]any{"env.meta": endpoint("json", "0s")}, "env.meta.region", "eu-west-1", 2, 1},
+		2: {map[string]any{"env.meta": endpoint("json", "1h")}, "env.meta.region", "eu-west-1", 2, 1},
+		3: {map[string]any{"env.conf": endpoint("toml", "")}, "env.conf.region", "eu-west-1", 3, 2},
+	}
+
+	for i, cas := range cases {
+		m, err := build(cas.cfg)
+		if err != nil {
+			t.Fatalf("%d: Build()=%+v", i, err)
+		}
+
+		got, err := Get[any](m, cas.path)
+		if err != nil {
+			t.Fatalf("%d: Get()=%+v", i, err)
+		}
+
+		if !cmp.Equal(got, cas.want) {
+			t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, cas.want))
+		}
+
+		if n := atomic.LoadInt32(&requests); n != cas.requests {
+			t.Fatalf("%d: got %d requests, want %d", i, n, cas.requests)
+		}
+
+		if n := atomic.LoadInt32(&fetches); n != cas.fetches {
+			t.Fatalf("%d: got %d fetches, want %d", i, n, cas.fetches)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "http", "*.json"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Glob()=%v, %+v, want 2 cache files", files, err)
+	}
+
+	for _, file := range files {
+		if p, err := os.ReadFile(file); err != nil || strings.Contains(string(p), "s3cr3t") {
+			t.Fatalf("%s: want cached file without secrets: %s, %+v", file, p, err)
+		}
+	}
+
+	errs := map[string]map[string]any{
+		"404 Not Found":     {"url": srv.URL + "/missing.json", "headers": map[string]any{"Authorization": "Bearer s3cr3t"}},
+		"401 Unauthorized":  {"url": srv.URL + "/envs/prod.json"},
+		"scheme":            {"url": "file:///etc/passwd"},
+		"templating header": {"url": srv.URL + "/envs/prod.json", "headers": map[string]any{"Authorization": "Bearer {{ .secrets.meta_token }}"}},
+	}
+
+	for want, cfg := range errs {
+		if _, err := build(map[string]any{"x": cfg}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Build()=%v, want error containing %q", err, want)
+		}
+	}
+
+	hb.MaxBody = 8
+
+	if _, err := build(map[string]any{"x": endpoint("toml", "")}); err == nil || !strings.Contains(err.Error(), "body exceeds 8 bytes") {
+		t.Errorf("Build()=%v, want error containing %q", err, "body exceeds 8 bytes")
+	}
+
+	hb.MaxBody = 0
+
+	m, err := build(map[string]any{"x": map[string]any{"url": srv.URL + "/missing.json", "optional": true}})
+	if err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	if _, err := Get[any](m, "x"); err == nil {
+		t.Fatalf("want optional key to be unset")
+	}
+}
@@ -0,0 +1,175 @@
+package context
+
+import (
+	"bytes"
+	"fmt"
+
+	"rafal.dev/reflow/pkg/keypath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetYAML sets v under the path in the YAML document p, editing its node
+// tree, so the comments and tags, like !reset, of the document are kept.
+//
+// Missing keys are created as maps, an index equal to the length of a list
+// appends to it, while other indices out of the range of a list, wildcards
+// and paths crossing scalar values are errors.
+func SetYAML(p []byte, path keypath.Path, v any) ([]byte, error) {
+	if path.Wildcard() {
+		return nil, fmt.Errorf("set %q: wildcards are not supported", path)
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(p, &doc); err != nil {
+		return nil, fmt.Errorf("set %q: %w", path, err)
+	}
+
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+
+	var x yaml.Node
+
+	if err := x.Encode(v); err != nil {
+		return nil, fmt.Errorf("set %q: %w", path, err)
+	}
+
+	if err := setNode(doc.Content[0], path, path, &x); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("set %q: %w", path, err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("set %q: %w", path, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func setNode(n *yaml.Node, full, p keypath.Path, x *yaml.Node) error {
+	if len(p) == 0 {
+		replaceNode(n, x)
+		return nil
+	}
+
+	seg, rest := p[0], p[1:]
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		if seg.Kind == keypath.Index {
+			return fmt.Errorf("set %q: cannot index map with %s", full, seg)
+		}
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == seg.Key {
+				return setNode(n.Content[i+1], full, rest, x)
+			}
+		}
+
+		v, err := newNode(full, rest, x)
+		if err != nil {
+			return err
+		}
+
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: seg.Key}, v)
+
+		return nil
+	case yaml.SequenceNode:
+		if seg.Kind == keypath.Key && !seg.Numeric {
+			return fmt.Errorf("set %q: cannot look up key %s in list", full, seg)
+		}
+
+		i := seg.Index
+		if i < 0 {
+			i += len(n.Content)
+		}
+
+		switch {
+		case i >= 0 && i < len(n.Content):
+			return setNode(n.Content[i], full, rest, x)
+		case i == len(n.Content):
+			v, err := newNode(full, rest, x)
+			if err != nil {
+				return err
+			}
+
+			n.Content = append(n.Content, v)
+
+			return nil
+		default:
+			return fmt.Errorf("set %q: index %d out of range of list of length %d", full, seg.Index, len(n.Content))
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			v, err := newNode(full, p, x)
+			if err != nil {
+				return err
+			}
+
+			*n = *v
+
+			return nil
+		}
+
+		return fmt.Errorf("set %q: cannot set %s under scalar %q", full, seg, n.Value)
+	case yaml.AliasNode:
+		return fmt.Errorf("set %q: cannot set %s under alias", full, seg)
+	default:
+		return fmt.Errorf("set %q: unexpected node kind %d", full, n.Kind)
+	}
+}
+
+// newNode returns x nested under new maps for the keys of the path.
+func newNode(full, p keypath.Path, x *yaml.Node) (*yaml.Node, error) {
+	if len(p) == 0 {
+		return x, nil
+	}
+
+	if p[0].Kind == keypath.Index {
+		return nil, fmt.Errorf("set %q: index %s out of range of missing list", full, p[0])
+	}
+
+	v, err := newNode(full, p[1:], x)
+	if err != nil {
+		return nil, err
+	}
+
+	return &yaml.Node{
+		Kind: yaml.MappingNode,
+		Tag:  "!!map",
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: p[0].Key},
+			v,
+		},
+	}, nil
+}
+
+// replaceNode replaces n with x, keeping the comments and the reset
+// tag of n.
+func replaceNode(n, x *yaml.Node) {
+	var (
+		head, line, foot = n.HeadComment, n.LineComment, n.FootComment
+		reset            = n.Tag == resetTag
+	)
+
+	*n = *x
+
+	n.HeadComment, n.LineComment, n.FootComment = head, line, foot
+
+	if reset {
+		n.Tag = resetTag
+	}
+}
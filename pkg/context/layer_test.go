@@ -0,0 +1,69 @@
+package context
+
+import (
+	"testing"
+
+	"rafal.dev/reflow/pkg/keypath"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSetYAML(t *testing.T) {
+	const doc = `# Image of the deployment.
+image: !reset
+  repo: reflow # the repository
+  tag: latest
+args: [a, b]
+`
+
+	cases := []struct {
+		path string
+		v    any
+		want string
+	}{
+		0: {
+			"image.tag",
+			"v1.0.0",
+			"# Image of the deployment.\nimage: !reset\n  repo: reflow # the repository\n  tag: v1.0.0\nargs: [a, b]\n",
+		},
+		1: {
+			"image.repo",
+			"other",
+			"# Image of the deployment.\nimage: !reset\n  repo: other # the repository\n  tag: latest\nargs: [a, b]\n",
+		},
+		2: {
+			"args[-1]",
+			"c",
+			"# Image of the deployment.\nimage: !reset\n  repo: reflow # the repository\n  tag: latest\nargs: [a, c]\n",
+		},
+		3: {
+			"args.2",
+			"c",
+			"# Image of the deployment.\nimage: !reset\n  repo: reflow # the repository\n  tag: latest\nargs: [a, b, c]\n",
+		},
+		4: {
+			"env.prod.replicas",
+			2,
+			"# Image of the deployment.\nimage: !reset\n  repo: reflow # the repository\n  tag: latest\nargs: [a, b]\nenv:\n  prod:\n    replicas: 2\n",
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			p, err := SetYAML([]byte(doc), keypath.MustParse(cas.path), cas.v)
+			if err != nil {
+				t.Fatalf("%d: SetYAML()=%+v", i, err)
+			}
+
+			if got := string(p); !cmp.Equal(got, cas.want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, cas.want))
+			}
+		})
+	}
+
+	for _, path := range []string{"args[5]", "args.x", "image.tag.x", "image[0]", "args[*]"} {
+		if _, err := SetYAML([]byte(doc), keypath.MustParse(path), "x"); err == nil {
+			t.Errorf("SetYAML(%q): want error", path)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package context
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ListMerge int
+
+const (
+	ListReplace ListMerge = iota
+	ListAppend
+	ListUnique
+)
+
+var DefaultMerger = &Merger{}
+
+// Merger overlays values of a layer onto the context.
+//
+// Maps are merged recursively, lists are combined according to Lists,
+// a null value deletes an existing key and a value wrapped with Reset
+// (the !reset tag in YAML files) replaces the existing one as a whole.
+// Shallow restores the last-writer-wins behaviour per top-level key.
+//
+// Nested maps of dst are copied before they are merged into, so values
+// shared with other contexts, e.g. cached layers, are never modified.
+type Merger struct {
+	Lists   ListMerge
+	Shallow bool
+}
+
+type Reset struct {
+	Value any
+}
+
+func (mg *Merger) Merge(dst map[string]any, key string, v any) {
+	if mg.Shallow {
+		dst[key] = unwrap(v)
+		return
+	}
+
+	old, ok := dst[key]
+
+	switch v := v.(type) {
+	case Reset:
+		dst[key] = unwrap(v.Value)
+	case nil:
+		if ok {
+			delete(dst, key)
+		} else {
+			dst[key] = nil
+		}
+	case map[string]any:
+		o, isMap := old.(map[string]any)
+		if !isMap || o == nil {
+			dst[key] = unwrap(v)
+			return
+		}
+
+		o = copyMap(o)
+
+		for k, v := range v {
+			mg.Merge(o, k, v)
+		}
+
+		dst[key] = o
+	case []any:
+		o, isList := old.([]any)
+		if !isList {
+			dst[key] = unwrap(v)
+			return
+		}
+
+		dst[key] = mg.mergeList(o, unwrap(v).([]any))
+	default:
+		dst[key] = v
+	}
+}
+
+func (mg *Merger) mergeList(dst, src []any) []any {
+	switch mg.Lists {
+	case ListAppend:
+		return append(dst[:len(dst):len(dst)], src...)
+	case ListUnique:
+		list := append([]any(nil), dst...)
+
+	src:
+		for _, v := range src {
+			for _, w := range list {
+				if reflect.DeepEqual(v, w) {
+					continue src
+				}
+			}
+
+			list = append(list, v)
+		}
+
+		return list
+	default:
+		return src
+	}
+}
+
+func copyMap(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
+
+func unwrap(v any) any {
+	switch v := v.(type) {
+	case Reset:
+		return unwrap(v.Value)
+	case map[string]any:
+		m := make(map[string]any, len(v))
+
+		for k, v := range v {
+			m[k] = unwrap(v)
+		}
+
+		return m
+	case []any:
+		list := make([]any, len(v))
+
+		for i, v := range v {
+			list[i] = unwrap(v)
+		}
+
+		return list
+	default:
+		return v
+	}
+}
+
+const resetTag = "!reset"
+
+func unmarshalYAML(p []byte, v *any) error {
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(p, &doc); err != nil {
+		return err
+	}
+
+	var resets [][]any
+
+	walkYAML(&doc, nil, func(n *yaml.Node, path []any) {
+		if n.Tag == resetTag {
+			n.Tag = ""
+			resets = append(resets, append([]any(nil), path...))
+		}
+	})
+
+	if err := doc.Decode(v); err != nil {
+		return err
+	}
+
+	for _, path := range resets {
+		if len(path) == 0 {
+			*v = Reset{Value: *v}
+			continue
+		}
+
+		if err := wrapReset(*v, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkYAML(n *yaml.Node, path []any, fn func(*yaml.Node, []any)) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, n := range n.Content {
+			walkYAML(n, path, fn)
+		}
+		return
+	case yaml.MappingNode:
+		fn(n, path)
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			walkYAML(n.Content[i+1], append(path, n.Content[i].Value), fn)
+		}
+	case yaml.SequenceNode:
+		fn(n, path)
+
+		for i, n := range n.Content {
+			walkYAML(n, append(path, i), fn)
+		}
+	default:
+		fn(n, path)
+	}
+}
+
+func wrapReset(v any, path []any) error {
+	n := len(path) - 1
+
+	for _, k := range path[:n] {
+		switch it := v.(type) {
+		case map[string]any:
+			v = it[fmt.Sprint(k)]
+		case []any:
+			i, ok := k.(int)
+			if !ok || i >= len(it) {
+				return fmt.Errorf("%s: unable to reset value at %v", resetTag, path)
+			}
+
+			v = it[i]
+		default:
+			return fmt.Errorf("%s: unable to reset value at %v", resetTag, path)
+		}
+	}
+
+	switch it := v.(type) {
+	case map[string]any:
+		k := fmt.Sprint(path[n])
+		it[k] = Reset{Value: it[k]}
+	case []any:
+		i, ok := path[n].(int)
+		if !ok || i >= len(it) {
+			return fmt.Errorf("%s: unable to reset value at %v", resetTag, path)
+		}
+
+		it[i] = Reset{Value: it[i]}
+	default:
+		return fmt.Errorf("%s: unable to reset value at %v", resetTag, path)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMerge(t *testing.T) {
+	cases := []struct {
+		mg     *Merger
+		layers []string
+		want   any
+	}{
+		0: {
+			mg: DefaultMerger,
+			layers: []string{
+				"image: {repo: reflow, tag: latest}\nreplicas: 1",
+				"image: {tag: v1.0.0}",
+			},
+			want: map[string]any{
+				"image":    map[string]any{"repo": "reflow", "tag": "v1.0.0"},
+				"replicas": 1,
+			},
+		},
+		1: {
+			mg: DefaultMerger,
+			layers: []string{
+				"image: {repo: reflow, tag: latest}\nreplicas: 1",
+				"image: !reset {tag: v1.0.0}\nreplicas: null",
+			},
+			want: map[string]any{
+				"image": map[string]any{"tag": "v1.0.0"},
+			},
+		},
+		2: {
+			mg: &Merger{Lists: ListAppend},
+			layers: []string{
+				"args: [a, b]",
+				"args: [b, c]",
+			},
+			want: map[string]any{
+				"args": []any{"a", "b", "b", "c"},
+			},
+		},
+		3: {
+			mg: &Merger{Lists: ListUnique},
+			layers: []string{
+				"args: [a, b]",
+				"args: [b, c]",
+			},
+			want: map[string]any{
+				"args": []any{"a", "b", "c"},
+			},
+		},
+		4: {
+			mg: &Merger{Lists: ListAppend},
+			layers: []string{
+				"args: [a, b]",
+				"args: !reset [c]",
+			},
+			want: map[string]any{
+				"args": []any{"c"},
+			},
+		},
+		5: {
+			mg: &Merger{Shallow: true},
+			layers: []string{
+				"image: {repo: reflow, tag: latest}",
+				"image: {tag: v1.0.0}",
+			},
+			want: map[string]any{
+				"image": map[string]any{"tag": "v1.0.0"},
+			},
+		},
+		6: {
+			mg: DefaultMerger,
+			layers: []string{
+				"image: {repo: reflow}",
+				"!reset {replicas: 2}",
+			},
+			want: map[string]any{
+				"replicas": 2,
+			},
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			m := make(map[string]any)
+
+			for j, layer := range cas.layers {
+				var v any
+
+				if err := unmarshalYAML([]byte(layer), &v); err != nil {
+					t.Fatalf("%d: unmarshalYAML(%d)=%+v", i, j, err)
+				}
+
+				cas.mg.Merge(m, "values", v)
+			}
+
+			if got, want := m["values"], cas.want; !cmp.Equal(got, want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, want))
+			}
+		})
+	}
+}
+
+func TestMergeCopy(t *testing.T) {
+	var (
+		shared = map[string]any{"repo": "reflow", "tag": "latest"}
+		m      = map[string]any{"image": shared}
+	)
+
+	DefaultMerger.Merge(m, "image", map[string]any{"tag": "v1.0.0"})
+
+	if got, want := m["image"], (map[string]any{"repo": "reflow", "tag": "v1.0.0"}); !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	if got, want := shared, (map[string]any{"repo": "reflow", "tag": "latest"}); !cmp.Equal(got, want) {
+		t.Fatalf("shared map was modified:\n%s", cmp.Diff(got, want))
+	}
+}
@@ -0,0 +1,153 @@
+package context
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"rafal.dev/reflow/pkg/debug"
+)
+
+// ParBuilder runs independent builders concurrently, each one on its own
+// copy of the context. Once all of them finish, the values each builder
+// set or deleted are applied to the context in the order of the builders,
+// so the result is the same as if they were run sequentially, as long as
+// none of them reads values set by the others. Lists extended by more
+// than one builder are combined with the DefaultMerger.
+type ParBuilder []Builder
+
+var _ Builder = ParBuilder(nil)
+
+func (par ParBuilder) Build(ctx context.Context, m map[string]any) error {
+	var (
+		wg     sync.WaitGroup
+		prov   = ProvenanceFrom(ctx)
+		deltas = make([]map[string]any, len(par))
+		provs  = make([]*Provenance, len(par))
+		errs   = make([]error, len(par))
+	)
+
+	for i, b := range par {
+		wg.Add(1)
+
+		go func(i int, b Builder) {
+			defer wg.Done()
+
+			var (
+				ctx  = ctx
+				snap = unwrap(m).(map[string]any)
+			)
+
+			if prov != nil {
+				provs[i] = NewProvenance()
+				ctx = WithProvenance(ctx, provs[i])
+			}
+
+			debug.Logf(ctx, "building %T", b)
+
+			if errs[i] = b.Build(ctx, snap); errs[i] == nil {
+				deltas[i] = diff(m, snap)
+			}
+		}(i, b)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%T: %w", par[i], err)
+		}
+	}
+
+	for i, delta := range deltas {
+		apply(m, delta, DefaultMerger)
+		prov.add(provs[i])
+	}
+
+	return nil
+}
+
+// deleted marks the keys deleted by a builder in its delta.
+type deleted struct{}
+
+// extended marks a list, which a builder extended with the Tail.
+type extended struct {
+	List []any
+	Tail []any
+}
+
+// diff returns the values that were set in the cur map, compared to
+// the old one, with the deleted and extended markers for the deleted
+// keys and the lists that got new elements.
+func diff(old, cur map[string]any) map[string]any {
+	delta := make(map[string]any)
+
+	for k, v := range cur {
+		o, ok := old[k]
+
+		switch o := o.(type) {
+		case map[string]any:
+			if vm, isMap := v.(map[string]any); isMap {
+				if d := diff(o, vm); len(d) != 0 {
+					delta[k] = d
+				}
+
+				continue
+			}
+		case []any:
+			if vl, isList := v.([]any); isList && len(vl) > len(o) && reflect.DeepEqual(vl[:len(o)], o) {
+				delta[k] = extended{List: vl, Tail: vl[len(o):]}
+				continue
+			}
+		case nil:
+			if vl, isList := v.([]any); isList && !ok {
+				delta[k] = extended{List: vl, Tail: vl}
+				continue
+			}
+		}
+
+		if !ok || !reflect.DeepEqual(o, v) {
+			delta[k] = v
+		}
+	}
+
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			delta[k] = deleted{}
+		}
+	}
+
+	return delta
+}
+
+// apply sets the values of the delta in the m, merging maps into their
+// copies and lists extended by the builders with the mg, so they are
+// combined with the ones extended by preceding builders. Other values,
+// including nil ones, replace the existing values.
+func apply(m, delta map[string]any, mg *Merger) {
+	for k, v := range delta {
+		switch v := v.(type) {
+		case deleted:
+			delete(m, k)
+		case extended:
+			if mg.Lists == ListReplace {
+				m[k] = unwrap(v.List)
+			} else {
+				mg.Merge(m, k, v.Tail)
+			}
+		case map[string]any:
+			mm, ok := m[k].(map[string]any)
+			if !ok || mm == nil {
+				m[k] = unwrap(v)
+				continue
+			}
+
+			mm = copyMap(mm)
+			apply(mm, v, mg)
+			m[k] = mm
+		default:
+			m[k] = unwrap(v)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package context
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type builderFunc func(context.Context, map[string]any) error
+
+func (fn builderFunc) Build(ctx context.Context, m map[string]any) error {
+	return fn(ctx, m)
+}
+
+func TestParBuilder(t *testing.T) {
+	sleep := func(d time.Duration, fn func(m map[string]any)) Builder {
+		return builderFunc(func(_ context.Context, m map[string]any) error {
+			time.Sleep(d)
+			fn(m)
+			return nil
+		})
+	}
+
+	var (
+		prov = NewProvenance()
+		ctx  = WithProvenance(context.Background(), prov)
+		m    = map[string]any{
+			"values": map[string]any{"env": "dev", "debug": true, "keep": 1},
+		}
+	)
+
+	b := ParBuilder{
+		&DirBuilder{Dir: fstest.MapFS{
+			"values.yaml": {Data: []byte("env: staging\nreplicas: 1\n")},
+		}},
+		sleep(20*time.Millisecond, func(m map[string]any) {
+			Set(m, "values.env", "prod")
+			Del(m, "values.debug")
+		}),
+		sleep(0, func(m map[string]any) {
+			Set(m, "values.env", "test")
+			Set(m, "values.tags", []any{"a"})
+		}),
+	}
+
+	if err := b.Build(ctx, m); err != nil {
+		t.Fatalf("Build()=%s", err)
+	}
+
+	want := map[string]any{
+		"values": map[string]any{
+			"env":      "test",
+			"replicas": 1,
+			"keep":     1,
+			"tags":     []any{"a"},
+		},
+	}
+
+	if !cmp.Equal(m, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(m, want))
+	}
+
+	if got, want := prov.Paths("values"), []string{"values.env", "values.replicas"}; !cmp.Equal(got, want) {
+		t.Fatalf("Paths(): got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	var (
+		old = map[string]any{"tags": []any{"a"}, "env": "dev"}
+		mg  = &Merger{Lists: ListAppend}
+	)
+
+	m = map[string]any{"tags": []any{"a"}, "env": "dev"}
+
+	for _, layer := range []map[string]any{
+		{"tags": []any{"b"}, "labels": []any{"x"}, "env": nil},
+		{"tags": []any{"c"}, "labels": []any{"y"}, "debug": nil},
+	} {
+		cur := unwrap(old).(map[string]any)
+
+		for k, v := range layer {
+			mg.Merge(cur, k, v)
+		}
+
+		apply(m, diff(old, cur), mg)
+	}
+
+	want = map[string]any{
+		"tags":   []any{"a", "b", "c"},
+		"labels": []any{"x", "y"},
+		"debug":  nil,
+	}
+
+	if !cmp.Equal(m, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(m, want))
+	}
+
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+
+	b = ParBuilder{
+		sleep(0, func(map[string]any) {}),
+		builderFunc(func(context.Context, map[string]any) error {
+			time.Sleep(20 * time.Millisecond)
+			return errFirst
+		}),
+		builderFunc(func(context.Context, map[string]any) error {
+			return errSecond
+		}),
+	}
+
+	if err := b.Build(context.Background(), map[string]any{}); !errors.Is(err, errFirst) {
+		t.Fatalf("got %v, want %v", err, errFirst)
+	}
+}
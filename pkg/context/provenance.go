@@ -0,0 +1,265 @@
+package context
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"rafal.dev/reflow/pkg/keypath"
+	"rafal.dev/reflow/pkg/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+type provenanceKey struct{}
+
+// Origin describes where a context value came from.
+type Origin struct {
+	Builder   string
+	Source    string
+	Line      int
+	Templated bool
+}
+
+func (o Origin) String() string {
+	var buf strings.Builder
+
+	buf.WriteString(o.Builder)
+
+	if o.Source != "" {
+		buf.WriteString(" " + o.Source)
+
+		if o.Line != 0 {
+			fmt.Fprintf(&buf, ":%d", o.Line)
+		}
+	}
+
+	if o.Templated {
+		buf.WriteString(" (templated)")
+	}
+
+	return buf.String()
+}
+
+// Layer is a value loaded from a single file, before it was merged
+// into the context.
+type Layer struct {
+	Key    string
+	Source string
+	Value  any
+}
+
+// Provenance records the origins of every leaf value set by builders,
+// in the order they were applied, and the layers loaded from files.
+type Provenance struct {
+	mu     sync.Mutex
+	m      map[string][]Origin
+	layers []Layer
+}
+
+func NewProvenance() *Provenance {
+	return &Provenance{m: make(map[string][]Origin)}
+}
+
+func WithProvenance(ctx context.Context, p *Provenance) context.Context {
+	return context.WithValue(ctx, provenanceKey{}, p)
+}
+
+func ProvenanceFrom(ctx context.Context) *Provenance {
+	p, _ := ctx.Value(provenanceKey{}).(*Provenance)
+	return p
+}
+
+func (p *Provenance) Record(path string, o Origin) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.m[path] = append(p.m[path], o)
+}
+
+// AddLayer records the value loaded from a file.
+func (p *Provenance) AddLayer(l Layer) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.layers = append(p.layers, l)
+}
+
+// Layers returns the recorded layers, in the order they were applied.
+func (p *Provenance) Layers() []Layer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Layer(nil), p.layers...)
+}
+
+// add appends the origins recorded by q, in lexical order of their paths,
+// and its layers.
+func (p *Provenance) add(q *Provenance) {
+	if p == nil || q == nil {
+		return
+	}
+
+	for _, l := range q.Layers() {
+		p.AddLayer(l)
+	}
+
+	for _, path := range q.Paths("") {
+		for _, o := range q.Origins(path) {
+			p.Record(path, o)
+		}
+	}
+}
+
+// Origins returns the origins of the value under the path, the last
+// one being the source of the current value and the preceding ones
+// the layers it overrode.
+func (p *Provenance) Origins(path string) []Origin {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Origin(nil), p.m[path]...)
+}
+
+// Paths returns sorted paths of all recorded leaves under the prefix.
+func (p *Provenance) Paths(prefix string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var paths []string
+
+	for path := range p.m {
+		if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[") {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+func record(ctx context.Context, path string, v any, o Origin) {
+	p := ProvenanceFrom(ctx)
+	if p == nil {
+		return
+	}
+
+	recordLines(p, path, v, o, nil)
+}
+
+func recordLines(p *Provenance, path string, v any, o Origin, lines map[string]int) {
+	switch v := v.(type) {
+	case Reset:
+		recordLines(p, path, v.Value, o, lines)
+	case map[string]any:
+		if len(v) == 0 {
+			break
+		}
+
+		for k, v := range v {
+			recordLines(p, path+"."+keypath.Join(k), v, o, lines)
+		}
+
+		return
+	}
+
+	if n, ok := lines[path]; ok {
+		o.Line = n
+	}
+
+	p.Record(path, o)
+}
+
+func yamlLines(prefix string, p []byte) map[string]int {
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(p, &doc); err != nil {
+		return nil
+	}
+
+	lines := make(map[string]int)
+
+	walkYAML(&doc, nil, func(n *yaml.Node, path []any) {
+		switch k := keypath.Join(path...); {
+		case k == "":
+			lines[prefix] = n.Line
+		case strings.HasPrefix(k, "["):
+			lines[prefix+k] = n.Line
+		default:
+			lines[prefix+"."+k] = n.Line
+		}
+	})
+
+	return lines
+}
+
+// sourceLines returns the lines of the values in the source of the file.
+// Actions of templated files are removed, keeping the line breaks, so
+// the values set by them are reported at their lines in the source.
+func sourceLines(prefix, file string, src []byte, templated bool) map[string]int {
+	if !templated {
+		return yamlLines(prefix, src)
+	}
+
+	o, body, err := template.Options{}.File(file, string(src))
+	if err != nil {
+		return nil
+	}
+
+	var (
+		left, right = "{{", "}}"
+		s           = strings.Repeat("\n", bytes.Count(src, []byte("\n"))-strings.Count(body, "\n")) + body
+	)
+
+	if o.Delims[0] != "" {
+		left, right = o.Delims[0], o.Delims[1]
+	}
+
+	return yamlLines(prefix, []byte(stripActions(s, left, right)))
+}
+
+func stripActions(s, left, right string) string {
+	var buf strings.Builder
+
+	for {
+		i := strings.Index(s, left)
+		if i == -1 {
+			break
+		}
+
+		j := strings.Index(s[i:], right)
+		if j == -1 {
+			break
+		}
+
+		buf.WriteString(s[:i])
+		buf.WriteString(strings.Repeat("\n", strings.Count(s[i:i+j], "\n")))
+
+		s = s[i+j+len(right):]
+	}
+
+	buf.WriteString(s)
+
+	return buf.String()
+}
+
+func sourceFile(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,60 @@
+package context
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProvenance(t *testing.T) {
+	var (
+		prov = NewProvenance()
+		ctx  = WithProvenance(context.Background(), prov)
+		m    = make(map[string]any)
+	)
+
+	b := SeqBuilder{
+		&DirBuilder{Dir: fstest.MapFS{
+			"values.yaml": {Data: []byte("image:\n  repo: reflow\n  tag: latest\n")},
+		}},
+		&DirBuilder{Dir: fstest.MapFS{
+			"values.yaml": {Data: []byte("replicas: 1\nimage:\n  tag: '{{ .values.image.repo }}'\n")},
+		}, Conv: Template},
+		&DirBuilder{Dir: fstest.MapFS{
+			"other.yaml": {Data: []byte("---\ndelims: ['[[', ']]']\n---\n[[- if true ]]\nname: [[ .values.image.repo ]]\n[[- end ]]\n")},
+		}, Path: "templates", Conv: Template},
+	}
+
+	if err := b.Build(ctx, m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	cases := map[string][]Origin{
+		"values.image.repo": {
+			{Builder: "*context.DirBuilder", Source: "values.yaml", Line: 2},
+		},
+		"values.image.tag": {
+			{Builder: "*context.DirBuilder", Source: "values.yaml", Line: 3},
+			{Builder: "*context.DirBuilder", Source: "values.yaml", Line: 3, Templated: true},
+		},
+		"values.replicas": {
+			{Builder: "*context.DirBuilder", Source: "values.yaml", Line: 1, Templated: true},
+		},
+		"other.name": {
+			{Builder: "*context.DirBuilder", Source: filepath.Join("templates", "other.yaml"), Line: 5, Templated: true},
+		},
+	}
+
+	for path, want := range cases {
+		if got := prov.Origins(path); !cmp.Equal(got, want) {
+			t.Errorf("%s: got != want:\n%s", path, cmp.Diff(got, want))
+		}
+	}
+
+	if got, want := prov.Paths("values.image"), []string{"values.image.repo", "values.image.tag"}; !cmp.Equal(got, want) {
+		t.Errorf("Paths(): got != want:\n%s", cmp.Diff(got, want))
+	}
+}
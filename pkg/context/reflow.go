@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"strings"
 
+	"rafal.dev/reflow/pkg/lazy"
+
 	"github.com/google/go-github/v43/github"
 )
 
@@ -15,6 +17,11 @@ type ReflowBuilder struct {
 
 func (rb *ReflowBuilder) Build(ctx context.Context, m map[string]any) error {
 	event, err := Get[string](m, "github.event_name")
+	if ke := (*KeyError)(nil); errors.As(err, &ke) {
+		if _, e := Get[string](m, "git.head"); e == nil {
+			return rb.buildGit(ctx, m)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("git builder: %w", err)
 	}
@@ -31,8 +38,13 @@ func (rb *ReflowBuilder) Build(ctx context.Context, m map[string]any) error {
 
 	owner, repo := v[0], v[1]
 
-	Set(m, "reflow.owner", owner)
-	Set(m, "reflow.repo", repo)
+	if err := rb.set(ctx, m, "reflow.owner", owner, "github.repository"); err != nil {
+		return fmt.Errorf("%s: git builder: %w", event, err)
+	}
+
+	if err := rb.set(ctx, m, "reflow.repo", repo, "github.repository"); err != nil {
+		return fmt.Errorf("%s: git builder: %w", event, err)
+	}
 
 	switch event {
 	case "issue_comment":
@@ -62,15 +74,37 @@ func (rb *ReflowBuilder) buildIssueComment(ctx context.Context, m map[string]any
 		return err
 	}
 
-	pr, _, err := rb.Client.PullRequests.Get(ctx, owner, repo, num)
-	if err != nil {
-		return fmt.Errorf("error getting pull request: %w", err)
+	// The pull request is fetched only when reflow.ref or reflow.sha
+	// is actually used.
+	pr := lazy.New(func() (any, error) {
+		pr, _, err := rb.Client.PullRequests.Get(ctx, owner, repo, num)
+		if err != nil {
+			return nil, fmt.Errorf("error getting pull request: %w", err)
+		}
+
+		return pr, nil
+	})
+
+	head := func(fn func(*github.PullRequestBranch) string) *lazy.Value {
+		return lazy.New(func() (any, error) {
+			v, err := pr.Get()
+			if err != nil {
+				return nil, err
+			}
+
+			return fn(v.(*github.PullRequest).Head), nil
+		})
 	}
 
-	var ref, sha string = *pr.Head.Ref, *pr.Head.SHA
+	source := fmt.Sprintf("GET /repos/%s/%s/pulls/%d", owner, repo, num)
+
+	if err := rb.set(ctx, m, "reflow.ref", head((*github.PullRequestBranch).GetRef), source); err != nil {
+		return err
+	}
 
-	Set(m, "reflow.ref", ref)
-	Set(m, "reflow.sha", sha)
+	if err := rb.set(ctx, m, "reflow.sha", head((*github.PullRequestBranch).GetSHA), source); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -86,8 +120,13 @@ func (rb *ReflowBuilder) buildPush(ctx context.Context, m map[string]any, owner,
 		return err
 	}
 
-	Set(m, "reflow.ref", ref)
-	Set(m, "reflow.sha", sha)
+	if err := rb.set(ctx, m, "reflow.ref", ref, "github.ref"); err != nil {
+		return err
+	}
+
+	if err := rb.set(ctx, m, "reflow.sha", sha, "github.sha"); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -103,8 +142,56 @@ func (rb *ReflowBuilder) buildPullRequest(ctx context.Context, m map[string]any,
 		return err
 	}
 
-	Set(m, "reflow.ref", ref)
-	Set(m, "reflow.sha", sha)
+	if err := rb.set(ctx, m, "reflow.ref", ref, "github.event.pull_request.head.ref"); err != nil {
+		return err
+	}
+
+	if err := rb.set(ctx, m, "reflow.sha", sha, "github.event.pull_request.head.sha"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// buildGit falls back to the local checkout metadata set by GitBuilder
+// when there is no GitHub event to read the ref from.
+func (rb *ReflowBuilder) buildGit(ctx context.Context, m map[string]any) error {
+	sha, err := Get[string](m, "git.head")
+	if err != nil {
+		return fmt.Errorf("git builder: %w", err)
+	}
+
+	ref := sha
+
+	if branch, err := Get[string](m, "git.branch"); err == nil && branch != "" {
+		ref = "refs/heads/" + branch
+	}
+
+	for _, k := range []string{"owner", "repo"} {
+		if v, err := Get[string](m, "git."+k); err == nil {
+			if err := rb.set(ctx, m, "reflow."+k, v, "git."+k); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := rb.set(ctx, m, "reflow.ref", ref, "git.branch"); err != nil {
+		return err
+	}
+
+	if err := rb.set(ctx, m, "reflow.sha", sha, "git.head"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rb *ReflowBuilder) set(ctx context.Context, m map[string]any, path string, v any, source string) error {
+	if _, err := Set(m, path, v); err != nil {
+		return err
+	}
+
+	record(ctx, path, v, Origin{Builder: fmt.Sprintf("%T", rb), Source: source})
 
 	return nil
 }
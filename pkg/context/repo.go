@@ -0,0 +1,289 @@
+package context
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"rafal.dev/reflow/internal/misc"
+	"rafal.dev/reflow/pkg/debug"
+
+	"github.com/google/go-github/v43/github"
+	"gopkg.in/yaml.v3"
+)
+
+// RepoBuilder loads the context/ directory found under the Path of the
+// GitHub Repository at the Ref, so defaults shared across runners can be
+// kept in a single config repository, e.g. with the following
+// $REFLOW_HOME/repo.yaml:
+//
+//	repository: org/reflow-config
+//	path: defaults
+//	ref: v1.2.0
+//
+// The Ref is resolved to a commit SHA, which contents are downloaded
+// with the tarball API once and cached in the CacheDir. Pinning the Ref
+// to a SHA makes the builder work offline once cached.
+//
+// If Repository is empty, it is read from the Config file, if any.
+// Without a repository the builder does nothing.
+//
+// The templates/ directory of the repository is loaded by the builder
+// returned by Templates, which runs later in the sequence, so the
+// templates see the context built in between.
+type RepoBuilder struct {
+	Repo
+	Client   *github.Client
+	CacheDir string
+	Config   string
+
+	dir string // set by Build
+}
+
+type Repo struct {
+	Repository string `yaml:"repository"`
+	Path       string `yaml:"path"`
+	Ref        string `yaml:"ref"`
+}
+
+var _ Builder = (*RepoBuilder)(nil)
+
+var shaRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func (rb *RepoBuilder) Build(ctx context.Context, m map[string]any) error {
+	rb.dir = ""
+
+	cfg, err := rb.config()
+	if err != nil {
+		return fmt.Errorf("repo builder: %w", err)
+	}
+
+	if cfg.Repository == "" {
+		return nil
+	}
+
+	owner, repo, ok := strings.Cut(cfg.Repository, "/")
+	if !ok || owner == "" || repo == "" {
+		return fmt.Errorf("repo builder: invalid repository: %q", cfg.Repository)
+	}
+
+	sha := cfg.Ref
+
+	if !shaRe.MatchString(sha) {
+		if sha, _, err = rb.client().Repositories.GetCommitSHA1(ctx, owner, repo, misc.Nonzero(cfg.Ref, "HEAD"), ""); err != nil {
+			return fmt.Errorf("repo builder: resolving %s@%s: %w", cfg.Repository, cfg.Ref, err)
+		}
+	}
+
+	dir := filepath.Join(rb.CacheDir, "repos", owner, repo, sha)
+
+	if p := strings.Trim(path.Clean("/"+cfg.Path), "/"); p != "" {
+		h := sha256.Sum256([]byte(p))
+		dir += "-" + hex.EncodeToString(h[:4])
+	}
+
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		if err := rb.download(ctx, owner, repo, sha, cfg.Path, dir); err != nil {
+			return fmt.Errorf("repo builder: downloading %s@%s: %w", cfg.Repository, sha, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("repo builder: %w", err)
+	} else {
+		debug.Logf(ctx, "%T: using cached %s@%s", rb, cfg.Repository, sha)
+	}
+
+	rb.dir = dir
+
+	contextDir := filepath.Join(dir, "context")
+
+	b := &DirBuilder{Dir: os.DirFS(contextDir), Path: contextDir, Exclude: Protected, Recursive: true}
+
+	if err := b.Build(ctx, m); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("repo builder: %w", err)
+	}
+
+	return nil
+}
+
+// Templates returns the builder loading the templates/ directory of the
+// repository fetched by the last Build of rb, executed with the conv,
+// or Template if nil. It does nothing if rb had no repository. Since it
+// reads the state of rb, the sequence holding both must not be built
+// concurrently.
+func (rb *RepoBuilder) Templates(conv func(ctx context.Context, file string, p []byte, m map[string]any) ([]byte, error)) Builder {
+	return &repoTemplates{rb: rb, conv: conv}
+}
+
+type repoTemplates struct {
+	rb   *RepoBuilder
+	conv func(ctx context.Context, file string, p []byte, m map[string]any) ([]byte, error)
+}
+
+func (rt *repoTemplates) Build(ctx context.Context, m map[string]any) error {
+	if rt.rb.dir == "" {
+		return nil
+	}
+
+	var (
+		templatesDir = filepath.Join(rt.rb.dir, "templates")
+		conv         = rt.conv
+	)
+
+	if conv == nil {
+		conv = Template
+	}
+
+	b := &DirBuilder{Dir: os.DirFS(templatesDir), Path: templatesDir, Conv: conv, Exclude: Protected}
+
+	if err := b.Build(ctx, m); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("repo builder: %w", err)
+	}
+
+	return nil
+}
+
+func (rb *RepoBuilder) config() (Repo, error) {
+	if rb.Repository != "" || rb.Config == "" {
+		return rb.Repo, nil
+	}
+
+	var cfg Repo
+
+	p, err := os.ReadFile(rb.Config)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := yaml.Unmarshal(p, &cfg); err != nil {
+		return cfg, fmt.Errorf("reading %q: %w", rb.Config, err)
+	}
+
+	return cfg, nil
+}
+
+func (rb *RepoBuilder) client() *github.Client {
+	if rb.Client != nil {
+		return rb.Client
+	}
+
+	return github.NewClient(nil)
+}
+
+// download extracts the files under the dir of the repository tarball
+// into the given directory.
+func (rb *RepoBuilder) download(ctx context.Context, owner, repo, sha, dir, dst string) error {
+	u, _, err := rb.client().Repositories.GetArchiveLink(ctx, owner, repo, github.Tarball, &github.RepositoryContentGetOptions{Ref: sha}, true)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET tarball: %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := untar(resp.Body, strings.Trim(path.Clean("/"+dir), "/"), tmp); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
+
+// untar extracts regular files under the prefix dir from the GitHub
+// tarball, which wraps all files in a single top-level directory.
+func untar(r io.Reader, dir, dst string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		_, name, ok := strings.Cut(path.Clean(hdr.Name), "/")
+		if !ok {
+			continue
+		}
+
+		if dir != "" {
+			rel := strings.TrimPrefix(name, dir+"/")
+			if rel == name {
+				continue
+			}
+
+			name = rel
+		}
+
+		if !fs.ValidPath(name) {
+			continue
+		}
+
+		file := filepath.Join(dst, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+}
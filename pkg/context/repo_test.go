@@ -0,0 +1,166 @@
+package context
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v43/github"
+)
+
+func TestRepoBuilder(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+
+	var resolves, downloads int32
+
+	archive := tarball(t, map[string]string{
+		"o-r-0123456/README.md":                       "ignored",
+		"o-r-0123456/defaults/context/values.yaml":    "image:\n  tag: v1\n",
+		"o-r-0123456/defaults/context/manifest.yaml":  "protected: true\n",
+		"o-r-0123456/defaults/templates/deploy.yaml":  "tag: {{ .values.image.tag }}\nsha: {{ .github.sha }}\n",
+		"o-r-0123456/other/context/values.yaml":       "other: true\n",
+		"o-r-0123456/defaults/../../../etc/evil.yaml": "evil: true\n",
+	})
+
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/o/r/commits/main":
+			atomic.AddInt32(&resolves, 1)
+			w.Write([]byte(sha))
+		case "/repos/o/r/tarball/" + sha:
+			http.Redirect(w, r, srv.URL+"/archive.tgz", http.StatusFound)
+		case "/archive.tgz":
+			atomic.AddInt32(&downloads, 1)
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	var (
+		dir    = t.TempDir()
+		config = filepath.Join(dir, "repo.yaml")
+	)
+
+	if err := os.WriteFile(config, []byte("repository: o/r\npath: defaults\nref: main\n"), 0644); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	want := map[string]any{
+		"values": map[string]any{
+			"image": map[string]any{"tag": "v1"},
+		},
+		"deploy": map[string]any{"tag": "v1", "sha": "abc"},
+		"github": map[string]any{"event_name": "push", "sha": "abc"},
+	}
+
+	env := &EnvBuilder{
+		GitHub:  true,
+		Environ: func() []string { return []string{"GITHUB_EVENT_NAME=push", "GITHUB_SHA=abc"} },
+	}
+
+	cases := []struct {
+		rb        *RepoBuilder
+		resolves  int32
+		downloads int32
+	}{{
+		&RepoBuilder{Client: client, CacheDir: dir, Config: config},
+		1, 1,
+	}, {
+		&RepoBuilder{Client: client, CacheDir: dir, Config: config},
+		2, 1,
+	}, {
+		&RepoBuilder{Client: client, CacheDir: dir, Repo: Repo{Repository: "o/r", Path: "defaults", Ref: sha}},
+		2, 1,
+	}}
+
+	for _, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			m := make(map[string]any)
+
+			b := SeqBuilder{
+				ParBuilder{cas.rb},
+				env,
+				cas.rb.Templates(nil),
+			}
+
+			if err := b.Build(context.Background(), m); err != nil {
+				t.Fatalf("Build()=%s", err)
+			}
+
+			if !cmp.Equal(m, want) {
+				t.Fatalf("got != want:\n%s", cmp.Diff(m, want))
+			}
+
+			if n := atomic.LoadInt32(&resolves); n != cas.resolves {
+				t.Fatalf("got %d resolves, want %d", n, cas.resolves)
+			}
+
+			if n := atomic.LoadInt32(&downloads); n != cas.downloads {
+				t.Fatalf("got %d downloads, want %d", n, cas.downloads)
+			}
+		})
+	}
+
+	if err := (&RepoBuilder{Client: client, CacheDir: dir}).Build(context.Background(), map[string]any{}); err != nil {
+		t.Fatalf("Build()=%s", err)
+	}
+
+	err := (&RepoBuilder{Client: client, CacheDir: dir, Repo: Repo{Repository: "o/r", Ref: "missing"}}).Build(context.Background(), map[string]any{})
+	if err == nil || !strings.Contains(err.Error(), "resolving o/r@missing") {
+		t.Fatalf("got %v, want resolving error", err)
+	}
+}
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var (
+		buf bytes.Buffer
+		gz  = gzip.NewWriter(&buf)
+		tw  = tar.NewWriter(gz)
+	)
+
+	for name, content := range files {
+		hdr := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader()=%s", err)
+		}
+
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Write()=%s", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	return buf.Bytes()
+}
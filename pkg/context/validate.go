@@ -0,0 +1,337 @@
+package context
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rafal.dev/reflow/pkg/keypath"
+	"rafal.dev/reflow/pkg/lazy"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Violation is a schema violation of a context value.
+type Violation struct {
+	Path    string
+	Message string
+	Origin  *Origin
+}
+
+func (v Violation) String() string {
+	s := v.Message
+	if v.Path != "" {
+		s = v.Path + ": " + s
+	}
+
+	if v.Origin == nil || v.Origin.Source == "" {
+		return s
+	}
+
+	src := v.Origin.Source
+	if v.Origin.Line != 0 {
+		src = fmt.Sprintf("%s:%d", src, v.Origin.Line)
+	}
+
+	return src + ": " + s
+}
+
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, len(e.Violations))
+
+	for i, v := range e.Violations {
+		s[i] = v.String()
+	}
+
+	return fmt.Sprintf("context does not match schema (%d violations):\n\t%s", len(s), strings.Join(s, "\n\t"))
+}
+
+// SchemaBuilder validates each top-level key of the context against
+// the schema of the same name found in the Dir, e.g. schemas/values.json
+// validates values. Keys without a schema or a value are not validated.
+type SchemaBuilder struct {
+	Dir fs.FS
+}
+
+var _ Builder = (*SchemaBuilder)(nil)
+
+func (sb *SchemaBuilder) Build(ctx context.Context, m map[string]any) error {
+	return Validate(ctx, sb.Dir, m)
+}
+
+// Validate reports all schema violations of the context m.
+//
+// If ctx carries Provenance, each layer loaded from a file is validated
+// on its own and its violations are reported with the file and the line
+// of the offending value. Since a layer may set only a part of a value,
+// required keys are checked against the merged context instead, and
+// their violations, which no single file is responsible for, are
+// reported without one.
+// Without Provenance the merged context is validated as a whole.
+func Validate(ctx context.Context, dir fs.FS, m map[string]any) error {
+	schemas, err := LoadSchemas(dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		prov = ProvenanceFrom(ctx)
+		errs []Violation
+	)
+
+	if prov != nil {
+		for _, l := range prov.Layers() {
+			path, err := keypath.Parse(l.Key)
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.Source, err)
+			}
+
+			sch, ok := schemas[path[0].Key]
+			if !ok {
+				continue
+			}
+
+			v, _, err := keypath.Set(nil, path[1:], unwrap(l.Value))
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.Source, err)
+			}
+
+			vs, err := validate(sch, path[0].Key, v, func(kw string) bool { return kw != "required" })
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.Source, err)
+			}
+
+			for _, v := range vs {
+				v.Origin = layerOrigin(prov, l.Source, v.Path)
+				errs = append(errs, v)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(schemas))
+
+	for k := range schemas {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, ok := m[k]
+		if !ok {
+			continue
+		}
+
+		vs, err := validate(schemas[k], k, v, func(kw string) bool { return prov == nil || kw == "required" })
+		if err != nil {
+			return err
+		}
+
+		errs = append(errs, vs...)
+	}
+
+	if len(errs) != 0 {
+		return &ValidationError{Violations: errs}
+	}
+
+	return nil
+}
+
+// LoadSchemas compiles all the *.json, *.yaml and *.yml schema files
+// found in the directory, keyed by their file name without extension.
+// The schemas may reference each other by file name.
+func LoadSchemas(dir fs.FS) (map[string]*jsonschema.Schema, error) {
+	entries, err := fs.ReadDir(dir, ".")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("schema loader: %w", err)
+	}
+
+	var (
+		c     = jsonschema.NewCompiler()
+		files []string
+	)
+
+	c.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("schema %q not found", s)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+
+		p, err := fs.ReadFile(dir, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("schema loader %q: %w", entry.Name(), err)
+		}
+
+		var v any
+
+		if err := yaml.Unmarshal(p, &v); err != nil {
+			return nil, fmt.Errorf("schema loader %q: %w", entry.Name(), err)
+		}
+
+		if p, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("schema loader %q: %w", entry.Name(), err)
+		}
+
+		if err := c.AddResource(schemaURL(entry.Name()), bytes.NewReader(p)); err != nil {
+			return nil, fmt.Errorf("schema loader %q: %w", entry.Name(), err)
+		}
+
+		files = append(files, entry.Name())
+	}
+
+	schemas := make(map[string]*jsonschema.Schema, len(files))
+
+	for _, file := range files {
+		s, err := c.Compile(schemaURL(file))
+		if err != nil {
+			return nil, fmt.Errorf("schema loader %q: %w", file, err)
+		}
+
+		schemas[strings.TrimSuffix(file, filepath.Ext(file))] = s
+	}
+
+	return schemas, nil
+}
+
+func schemaURL(file string) string {
+	return "mem://schemas/" + file
+}
+
+// validate returns the violations of v reported for the keywords
+// accepted by the filter.
+func validate(sch *jsonschema.Schema, root string, v any, filter func(keyword string) bool) ([]Violation, error) {
+	v, err := jsonValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", root, err)
+	}
+
+	var verr *jsonschema.ValidationError
+
+	if err := sch.Validate(v); !errors.As(err, &verr) {
+		return nil, err
+	}
+
+	var (
+		vs   []Violation
+		walk func(*jsonschema.ValidationError)
+	)
+
+	walk = func(e *jsonschema.ValidationError) {
+		for _, e := range e.Causes {
+			walk(e)
+		}
+
+		kw := e.KeywordLocation[strings.LastIndexByte(e.KeywordLocation, '/')+1:]
+
+		if len(e.Causes) == 0 && filter(kw) {
+			vs = append(vs, Violation{
+				Path:    instancePath(root, v, e.InstanceLocation),
+				Message: e.Message,
+			})
+		}
+	}
+
+	walk(verr)
+
+	sort.SliceStable(vs, func(i, j int) bool { return vs[i].Path < vs[j].Path })
+
+	return vs, nil
+}
+
+// jsonValue resolves the lazy values of v and converts it to the types
+// of decoded JSON, which are the only ones the schemas validate.
+func jsonValue(v any) (any, error) {
+	v, err := lazy.Resolve(v)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// instancePath converts the JSON pointer to the value in v
+// to a key path under the root.
+func instancePath(root string, v any, ptr string) string {
+	keys := []any{root}
+
+	for _, tok := range strings.Split(ptr, "/")[1:] {
+		tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+
+		switch t := v.(type) {
+		case []any:
+			i, _ := strconv.Atoi(tok)
+			keys = append(keys, i)
+
+			if i < len(t) {
+				v = t[i]
+			}
+		case map[string]any:
+			keys = append(keys, tok)
+			v = t[tok]
+		default:
+			keys = append(keys, tok)
+		}
+	}
+
+	return keypath.Join(keys...)
+}
+
+// layerOrigin finds the origin of the value under the path recorded for
+// the source file, falling back to the source itself.
+func layerOrigin(p *Provenance, source, path string) *Origin {
+	for {
+		for _, q := range p.Paths(path) {
+			o := p.Origins(q)
+
+			for i := len(o) - 1; i >= 0; i-- {
+				if o[i].Source == source {
+					return &o[i]
+				}
+			}
+		}
+
+		i := strings.LastIndexAny(path, ".[")
+		if i == -1 {
+			return &Origin{Source: source}
+		}
+
+		path = path[:i]
+	}
+}
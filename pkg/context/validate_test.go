@@ -0,0 +1,63 @@
+package context
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSchemaBuilder(t *testing.T) {
+	var (
+		ctx  = WithProvenance(context.Background(), NewProvenance())
+		m    = make(map[string]any)
+		verr *ValidationError
+	)
+
+	b := SeqBuilder{
+		&DirBuilder{Dir: fstest.MapFS{
+			"values.yaml": {Data: []byte("image:\n  repo: reflow\n  tag: 1\nreplicas: many\n")},
+		}, Path: "home"},
+		&DirBuilder{Dir: fstest.MapFS{
+			"values.yaml":       {Data: []byte("image:\n  tag: latest\nports:\n  - 80\n  - http\n")},
+			"values/extra.yaml": {Data: []byte("enabled: 'no'\n")},
+		}, Path: "run", Recursive: true},
+		&SchemaBuilder{Dir: fstest.MapFS{
+			"values.json": {Data: []byte(`{
+				"type": "object",
+				"required": ["env"],
+				"properties": {
+					"image": {"properties": {"tag": {"type": "string"}}},
+					"replicas": {"type": "integer"},
+					"ports": {"items": {"type": "integer"}},
+					"extra": {"properties": {"enabled": {"type": "boolean"}}}
+				}
+			}`)},
+			"manifest.yaml": {Data: []byte("required: [uses]\n")},
+		}},
+	}
+
+	if err := b.Build(ctx, m); !errors.As(err, &verr) {
+		t.Fatalf("Build()=%+v, want ValidationError", err)
+	}
+
+	var got []string
+
+	for _, v := range verr.Violations {
+		got = append(got, v.String())
+	}
+
+	want := []string{
+		`home/values.yaml:3: values.image.tag: expected string, but got number`,
+		`home/values.yaml:4: values.replicas: expected integer, but got string`,
+		`run/values.yaml:4: values.ports[1]: expected integer, but got string`,
+		`run/values/extra.yaml:1: values.extra.enabled: expected boolean, but got string`,
+		`values: missing properties: 'env'`,
+	}
+
+	if !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+}
@@ -2,24 +2,51 @@ package fmt
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
+	"rafal.dev/reflow/internal/misc"
+	"rafal.dev/reflow/pkg/codec"
 	c "rafal.dev/reflow/pkg/context"
+	"rafal.dev/reflow/pkg/lazy"
+	"rafal.dev/reflow/pkg/secret"
 	"rafal.dev/reflow/pkg/template"
-
-	"gopkg.in/yaml.v3"
 )
 
 var DefaultFormater = &Formater{
 	Builder: c.DefaultBuilder,
+	LoadKey: secret.DefaultKey,
+	SealDir: filepath.Join(misc.Home(), "runs"),
 }
 
 type Formater struct {
 	Builder c.Builder
+	Key     *secret.Key
+	LoadKey func() (*secret.Key, error)
+	SealDir string
+
+	// Template options to execute files with, template.Default if nil.
+	Template *template.Options
+}
+
+func (f *Formater) templateOptions() template.Options {
+	if f.Template != nil {
+		return *f.Template
+	}
+
+	return template.Default
+}
+
+// SecretKey returns the Key, or the one returned by LoadKey if unset.
+func (f *Formater) SecretKey() (*secret.Key, error) {
+	if f.Key != nil || f.LoadKey == nil {
+		return f.Key, nil
+	}
+
+	return f.LoadKey()
 }
 
 func (f *Formater) Format(ctx context.Context, in, out string, mask bool) error {
@@ -30,24 +57,25 @@ func (f *Formater) Format(ctx context.Context, in, out string, mask bool) error
 	}
 
 	if mask {
-		v, err := c.Get[[]any](m, "mask")
-		if err != nil {
-			return fmt.Errorf("mask keys: %w", err)
+		if err := c.Mask(m); err != nil {
+			return err
 		}
+	}
 
-		for _, v := range v {
-			if key := fmt.Sprint(v); c.Del(m, key) {
-				c.Set(m, key, "***")
-			}
-		}
+	p, err := f.ReadFile(in)
+	if err != nil {
+		return err
 	}
 
-	p, err := ioutil.ReadFile(in)
+	o, s, err := f.templateOptions().File(in, string(p))
 	if err != nil {
-		return fmt.Errorf("read file: %w", err)
+		return fmt.Errorf("template execute: %w", err)
 	}
 
-	if p, err = template.Execute(string(p), m); err != nil {
+	o.Name = in
+	o.Context = ctx
+
+	if p, err = o.Execute(s, m); err != nil {
 		return fmt.Errorf("template execute: %w", err)
 	}
 
@@ -64,46 +92,94 @@ func (f *Formater) Format(ctx context.Context, in, out string, mask bool) error
 	return nil
 }
 
-func (f *Formater) Marshal(v any, file string) (err error) {
-	var p []byte
-
-	switch ext := strings.ToLower(filepath.Ext(file)); ext {
-	case ".json":
-		p, err = json.Marshal(v)
-	case ".yaml", ".yml":
-		p, err = yaml.Marshal(v)
-	default:
-		err = fmt.Errorf("unsupported format: %q", ext)
+func (f *Formater) Marshal(v any, file string) error {
+	p, err := f.Encode(v, filepath.Ext(file))
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
 	}
 
+	return f.WriteFile(file, p)
+}
+
+func (f *Formater) Encode(v any, format string) ([]byte, error) {
+	v, err := lazy.Resolve(v)
 	if err != nil {
-		return fmt.Errorf("json marshal: %w", err)
+		return nil, err
+	}
+
+	return codec.Marshal(v, format)
+}
+
+func (f *Formater) WriteFile(file string, p []byte) error {
+	return f.writeFile(file, p, 0644)
+}
+
+func (f *Formater) writeFile(file string, p []byte, mode os.FileMode) (err error) {
+	if f.sealed(file) {
+		k, err := f.SecretKey()
+		if err != nil {
+			return fmt.Errorf("seal file: %w", err)
+		}
+
+		if k != nil {
+			if p, err = k.Seal(p); err != nil {
+				return fmt.Errorf("seal file: %w", err)
+			}
+
+			mode = 0600
+		}
 	}
 
-	if err := ioutil.WriteFile(file, p, 0644); err != nil {
+	if err := ioutil.WriteFile(file, p, mode); err != nil {
 		return fmt.Errorf("write file: %w", err)
 	}
 
 	return nil
 }
 
+func (f *Formater) ReadFile(file string) ([]byte, error) {
+	p, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	if secret.IsSealed(p) {
+		k, err := f.SecretKey()
+		if err != nil {
+			return nil, fmt.Errorf("open file: %w", err)
+		}
+
+		if p, err = k.Open(p); err != nil {
+			return nil, fmt.Errorf("open file: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+func (f *Formater) sealed(file string) bool {
+	if f.SealDir == "" {
+		return false
+	}
+
+	rel, err := filepath.Rel(f.SealDir, file)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func (f *Formater) Unmarshal(file string, v any) error {
 	return f.unmarshal(nil, file, v)
 }
 
 func (f *Formater) unmarshal(p []byte, file string, v any) (err error) {
 	if p == nil {
-		if p, err = ioutil.ReadFile(file); err != nil {
-			return fmt.Errorf("read file: %w", err)
+		if p, err = f.ReadFile(file); err != nil {
+			return err
 		}
 	}
 
-	switch ext := strings.ToLower(filepath.Ext(file)); ext {
-	case ".json", ".yaml", ".yml":
-		err = yaml.Unmarshal(p, v)
-	default:
-		err = fmt.Errorf("unsupported format: %q", ext)
-	}
-
-	return nil
+	return codec.Unmarshal(p, filepath.Ext(file), v)
 }
@@ -0,0 +1,172 @@
+package fmt
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"rafal.dev/reflow/pkg/codec"
+	"rafal.dev/reflow/pkg/template"
+)
+
+// Rendered describes a single file processed by Render.
+type Rendered struct {
+	Src     string
+	Out     string
+	Skipped bool
+}
+
+// Render renders each file found in the src directory into the out one,
+// executing both its content and its path as templates, so files can be
+// renamed or, if the path renders empty, skipped. The modes of the files
+// are preserved, and the inner .tmpl extensions are removed.
+//
+// The front matter of each file can make Render skip the file or convert
+// it to another format, see template.FrontMatter. The _partials directory
+// of the src is not rendered, its files are available as partials instead.
+func (f *Formater) Render(ctx context.Context, src, out string) ([]Rendered, error) {
+	m := make(map[string]any)
+
+	if err := f.Builder.Build(ctx, m); err != nil {
+		return nil, fmt.Errorf("formatter error: %w", err)
+	}
+
+	o := f.templateOptions()
+	o.Context = ctx
+	o.Partials = append(o.Partials[:len(o.Partials):len(o.Partials)], os.DirFS(filepath.Join(src, "_partials")))
+
+	var rendered []Rendered
+
+	err := filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if rel == "_partials" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		r, err := f.render(o, m, src, out, filepath.ToSlash(rel), d)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		rendered = append(rendered, r)
+
+		return nil
+	})
+
+	return rendered, err
+}
+
+func (f *Formater) render(o template.Options, m map[string]any, src, out, rel string, d fs.DirEntry) (Rendered, error) {
+	r := Rendered{Src: filepath.Join(src, filepath.FromSlash(rel)), Skipped: true}
+
+	o.Name = rel + " (path)"
+
+	name, err := o.Execute(rel, m)
+	if err != nil {
+		return r, err
+	}
+
+	// A file, or any of its directories, rendered empty is skipped.
+	for _, seg := range strings.Split(string(name), "/") {
+		switch seg {
+		case "":
+			return r, nil
+		case ".", "..":
+			return r, fmt.Errorf("invalid rendered path: %q", name)
+		}
+	}
+
+	p, err := f.ReadFile(r.Src)
+	if err != nil {
+		return r, err
+	}
+
+	fm, err := template.ReadFrontMatter(string(p))
+	if err != nil {
+		return r, err
+	}
+
+	o.Name = r.Src
+
+	o, s, err := o.File(rel, string(p))
+	if err != nil {
+		return r, err
+	}
+
+	if fm.Skip != "" {
+		q, err := o.Execute(fm.Skip, m)
+		if err != nil {
+			return r, fmt.Errorf("front matter: skip: %w", err)
+		}
+
+		if skip, _ := strconv.ParseBool(strings.TrimSpace(string(q))); skip {
+			return r, nil
+		}
+	}
+
+	if p, err = o.Execute(s, m); err != nil {
+		return r, err
+	}
+
+	var (
+		ext  = path.Ext(string(name))
+		base = strings.TrimSuffix(strings.TrimSuffix(string(name), ext), ".tmpl")
+	)
+
+	if fm.Format != "" {
+		var v any
+
+		if err := codec.Unmarshal(p, ext, &v); err != nil {
+			return r, fmt.Errorf("unmarshal: %w", err)
+		}
+
+		ext = "." + strings.TrimPrefix(fm.Format, ".")
+
+		if p, err = f.Encode(v, ext); err != nil {
+			return r, fmt.Errorf("encode: %w", err)
+		}
+	}
+
+	fi, err := d.Info()
+	if err != nil {
+		return r, err
+	}
+
+	r.Out = filepath.Join(out, filepath.FromSlash(base+ext))
+
+	if err := os.MkdirAll(filepath.Dir(r.Out), 0755); err != nil {
+		return r, err
+	}
+
+	if err := f.writeFile(r.Out, p, fi.Mode().Perm()); err != nil {
+		return r, err
+	}
+
+	// The mode is set on creation only, so existing files are updated too.
+	if !f.sealed(r.Out) {
+		if err := os.Chmod(r.Out, fi.Mode().Perm()); err != nil {
+			return r, err
+		}
+	}
+
+	r.Skipped = false
+
+	return r, nil
+}
@@ -0,0 +1,109 @@
+package fmt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	c "rafal.dev/reflow/pkg/context"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRender(t *testing.T) {
+	type file struct {
+		Data string
+		Mode os.FileMode
+	}
+
+	var (
+		src = t.TempDir()
+		out = t.TempDir()
+	)
+
+	files := map[string]file{
+		"deploy.tmpl.yaml":                       {"image: {{ .values.image }}\nsha: ${{ github.sha }}\n", 0644},
+		"run.sh":                                 {"#!/bin/sh\necho {{ .values.env }}\n", 0755},
+		"{{ .values.env }}/config.yaml":          {"---\nformat: json\n---\nreplicas: {{ .values.replicas }}\n", 0644},
+		"{{ if .values.debug }}debug{{ end }}/x": {"debug\n", 0644},
+		"skip.yaml":                              {"---\nskip: '{{ eq .values.env \"prod\" }}'\n---\nx: y\n", 0644},
+		"_partials/name.tpl":                     {"app-{{ .values.env }}", 0644},
+		"name.txt":                               {`{{ include "name" . }}`, 0644},
+	}
+
+	for name, f := range files {
+		name = filepath.Join(src, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(name, []byte(f.Data), f.Mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := &Formater{
+		Builder: &c.DirBuilder{Dir: fstest.MapFS{
+			"values.yaml": {Data: []byte("image: app:v1\nenv: prod\nreplicas: 3\ndebug: false\n")},
+		}},
+	}
+
+	rendered, err := f.Render(context.Background(), src, out)
+	if err != nil {
+		t.Fatalf("Render()=%s", err)
+	}
+
+	var skipped []string
+
+	for _, r := range rendered {
+		if r.Skipped {
+			rel, _ := filepath.Rel(src, r.Src)
+			skipped = append(skipped, filepath.ToSlash(rel))
+		}
+	}
+
+	if want := []string{"skip.yaml", "{{ if .values.debug }}debug{{ end }}/x"}; !cmp.Equal(skipped, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(skipped, want))
+	}
+
+	want := map[string]file{
+		"deploy.yaml":      {"image: app:v1\nsha: ${{ github.sha }}\n", 0644},
+		"run.sh":           {"#!/bin/sh\necho prod\n", 0755},
+		"prod/config.json": {`{"replicas":3}`, 0644},
+		"name.txt":         {"app-prod", 0644},
+	}
+
+	got := make(map[string]file)
+
+	err = filepath.WalkDir(out, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		p, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(out, path)
+
+		got[filepath.ToSlash(rel)] = file{string(p), fi.Mode().Perm()}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+}
@@ -0,0 +1,139 @@
+// Package jq evaluates jq expressions over the context with gojq.
+package jq
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+
+	"rafal.dev/reflow/pkg/lazy"
+
+	"github.com/itchyny/gojq"
+)
+
+// Query is a compiled jq expression.
+type Query struct {
+	src  string
+	code *gojq.Code
+}
+
+// Parse compiles the expression. The expression is hermetic, so its
+// env builtin and $ENV are empty.
+func Parse(s string) (*Query, error) {
+	return parse(s)
+}
+
+// ParseEnv compiles the expression, with the env builtin and $ENV
+// set to the environment of the process.
+func ParseEnv(s string) (*Query, error) {
+	return parse(s, gojq.WithEnvironLoader(os.Environ))
+}
+
+func parse(s string, opts ...gojq.CompilerOption) (*Query, error) {
+	q, err := gojq.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("jq %q: %w", s, err)
+	}
+
+	code, err := gojq.Compile(q, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("jq %q: %w", s, err)
+	}
+
+	return &Query{src: s, code: code}, nil
+}
+
+func (q *Query) String() string {
+	return q.src
+}
+
+// Run evaluates the query against v and returns all produced values.
+// Lazy values of v are resolved first.
+func (q *Query) Run(ctx context.Context, v any) ([]any, error) {
+	v, err := lazy.Resolve(v)
+	if err != nil {
+		return nil, fmt.Errorf("jq %q: %w", q.src, err)
+	}
+
+	var (
+		it  = q.code.RunWithContext(ctx, normalize(reflect.ValueOf(v)))
+		out []any
+	)
+
+	for {
+		x, ok := it.Next()
+		if !ok {
+			return out, nil
+		}
+
+		if err, ok := x.(error); ok {
+			return nil, fmt.Errorf("jq %q: %w", q.src, err)
+		}
+
+		out = append(out, x)
+	}
+}
+
+func Run(ctx context.Context, expr string, v any) ([]any, error) {
+	q, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Run(ctx, v)
+}
+
+// normalize copies v into the generic representation used by gojq,
+// converting values like []string or map[string]string coming from
+// Go code, so the query neither fails on them nor modifies v.
+func normalize(rv reflect.Value) any {
+	if !rv.IsValid() {
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if rv.IsNil() {
+			return nil
+		}
+
+		return normalize(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes())
+		}
+
+		list := make([]any, rv.Len())
+
+		for i := range list {
+			list[i] = normalize(rv.Index(i))
+		}
+
+		return list
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		m := make(map[string]any, rv.Len())
+
+		for it := rv.MapRange(); it.Next(); {
+			m[it.Key().String()] = normalize(it.Value())
+		}
+
+		return m
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+
+	return rv.Interface()
+}
@@ -0,0 +1,111 @@
+package jq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRun(t *testing.T) {
+	t.Setenv("REFLOW_JQ_TEST", "env")
+
+	v := map[string]any{
+		"tags": []string{"a", "b"},
+		"github": map[string]any{
+			"event": map[string]any{
+				"pull_request": map[string]any{
+					"number": 42,
+					"labels": []any{
+						map[string]any{"name": "bug", "id": 2},
+						map[string]any{"name": "ci.skip", "id": 1},
+					},
+				},
+			},
+		},
+		"values": map[string]any{
+			"image":    map[string]any{"repo": "reflow", "tag": "v1.0.0"},
+			"replicas": 3,
+		},
+	}
+
+	cases := []struct {
+		expr string
+		want []any
+	}{
+		0:  {".github.event.pull_request.number", []any{42}},
+		1:  {".github.event.pull_request.labels[].name", []any{"bug", "ci.skip"}},
+		2:  {"[.github.event.pull_request.labels[] | select(.id < 2) | .name]", []any{[]any{"ci.skip"}}},
+		3:  {".github.event.pull_request.labels | map(.name) | join(\",\")", []any{"bug,ci.skip"}},
+		4:  {".values | keys", []any{[]any{"image", "replicas"}}},
+		5:  {".values.image | .repo + \":\" + .tag", []any{"reflow:v1.0.0"}},
+		6:  {".values.missing // \"default\"", []any{"default"}},
+		7:  {"{tag: .values.image.tag, n: (.values.replicas * 2)}", []any{map[string]any{"tag": "v1.0.0", "n": 6}}},
+		8:  {".github.event.pull_request.labels | sort_by(.id) | .[0].name", []any{"ci.skip"}},
+		9:  {"if .values.replicas > 1 then \"ha\" else \"single\" end", []any{"ha"}},
+		10: {".values.image | to_entries | map(.key)", []any{[]any{"repo", "tag"}}},
+		11: {".values.replicas, .values.image.tag", []any{3, "v1.0.0"}},
+		12: {"[.. | select(type == \"number\")] | add", []any{48}},
+		13: {".values.replicas.foo?", nil},
+		14: {"[range(3)] | .[1:]", []any{[]any{1, 2}}},
+		15: {".github.event.pull_request.labels | map(.name == \"bug\") | any", []any{true}},
+		16: {"[.github.event.pull_request.labels[].name | test(\"^ci\\\\.\")]", []any{[]any{false, true}}},
+		17: {"-.values.replicas", []any{-3}},
+		18: {".values.image.tag as $tag | \"\\(.values.image.repo):\\($tag)\"", []any{"reflow:v1.0.0"}},
+		19: {"reduce .github.event.pull_request.labels[] as $l (0; . + $l.id)", []any{3}},
+		20: {"try error(\"boom\") catch .", []any{"boom"}},
+		21: {"def twice: . * 2; .values.replicas | twice", []any{6}},
+		22: {".values.image.repo | @base64", []any{"cmVmbG93"}},
+		23: {"[paths(type == \"string\")] | length", []any{6}},
+		24: {"$ENV.REFLOW_JQ_TEST", []any{nil}},
+		25: {".tags", []any{[]any{"a", "b"}}},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			got, err := Run(context.Background(), cas.expr, v)
+
+			if cas.want == nil {
+				if err == nil && got != nil {
+					t.Fatalf("%d: got %v, want no output or error", i, got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%d: Run()=%+v", i, err)
+			}
+
+			if !cmp.Equal(got, cas.want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, cas.want))
+			}
+		})
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	t.Setenv("REFLOW_JQ_TEST", "env")
+
+	q, err := ParseEnv("$ENV.REFLOW_JQ_TEST, env.REFLOW_JQ_TEST")
+	if err != nil {
+		t.Fatalf("ParseEnv()=%+v", err)
+	}
+
+	got, err := q.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Run()=%+v", err)
+	}
+
+	if want := []any{"env", "env"}; !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, expr := range []string{".a |", "[.a", "{a:}", "nosuchfunc", ".a ]", "\"unterminated"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): want error", expr)
+		}
+	}
+}
@@ -0,0 +1,563 @@
+package keypath
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Key Kind = iota
+	Index
+	Wildcard
+)
+
+// Segment is a single element of a key path.
+//
+// A bare numeric segment, like the 0 in labels.0.name, is a Key with
+// Numeric set - it indexes a list or looks up a map key, depending on
+// what it is applied to.
+type Segment struct {
+	Kind    Kind
+	Key     string
+	Index   int
+	Numeric bool
+}
+
+func (s Segment) String() string {
+	switch s.Kind {
+	case Index:
+		return "[" + strconv.Itoa(s.Index) + "]"
+	case Wildcard:
+		return "*"
+	default:
+		return quote(s.Key)
+	}
+}
+
+// Path is a parsed key path.
+//
+// Segments are separated with dots, keys containing special characters
+// are quoted with double or single quotes, list elements are selected
+// either with bare numbers or with brackets (negative indices count
+// from the end) and * matches every element of a map or a list:
+//
+//	github.event.pull_request.labels.0.name
+//	github.event.pull_request.labels[-1].name
+//	metadata.annotations."app.kubernetes.io/name"
+//	github.event.pull_request.labels[*].name
+type Path []Segment
+
+type Match struct {
+	Path  Path
+	Value any
+}
+
+func Parse(s string) (Path, error) {
+	if s == "" {
+		return nil, errors.New("empty key")
+	}
+
+	var (
+		p    Path
+		i    int
+		want = true
+	)
+
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '.':
+			if want {
+				return nil, fmt.Errorf("invalid key %q: empty segment at %d", s, i)
+			}
+
+			want = true
+			i++
+		case c == '[':
+			seg, n, err := parseBracket(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %q: %w", s, err)
+			}
+
+			p = append(p, seg)
+			i += n
+			want = false
+		case !want:
+			return nil, fmt.Errorf("invalid key %q: unexpected %q at %d", s, c, i)
+		case c == '"' || c == '\'':
+			key, n, err := unquote(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %q: %w", s, err)
+			}
+
+			p = append(p, Segment{Kind: Key, Key: key})
+			i += n
+			want = false
+		default:
+			j := strings.IndexAny(s[i:], ".[")
+			if j == -1 {
+				j = len(s) - i
+			}
+
+			if k := strings.IndexAny(s[i:i+j], `"'`); k != -1 {
+				return nil, fmt.Errorf("invalid key %q: unexpected quote at %d", s, i+k)
+			}
+
+			p = append(p, bare(s[i:i+j]))
+			i += j
+			want = false
+		}
+	}
+
+	if want {
+		return nil, fmt.Errorf("invalid key %q: trailing dot", s)
+	}
+
+	return p, nil
+}
+
+func MustParse(s string) Path {
+	p, err := Parse(s)
+	if err != nil {
+		panic("unexpected error: " + err.Error())
+	}
+
+	return p
+}
+
+func (p Path) String() string {
+	var buf strings.Builder
+
+	for i, seg := range p {
+		if i != 0 && seg.Kind != Index {
+			buf.WriteByte('.')
+		}
+
+		buf.WriteString(seg.String())
+	}
+
+	return buf.String()
+}
+
+func (p Path) Wildcard() bool {
+	for _, seg := range p {
+		if seg.Kind == Wildcard {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p Path) Append(seg ...Segment) Path {
+	return append(p[:len(p):len(p)], seg...)
+}
+
+// Join builds a path string out of raw map keys and list indices,
+// quoting keys where necessary.
+func Join(keys ...any) string {
+	p := make(Path, 0, len(keys))
+
+	for _, k := range keys {
+		switch k := k.(type) {
+		case int:
+			p = append(p, Segment{Kind: Index, Index: k})
+		default:
+			p = append(p, Segment{Kind: Key, Key: fmt.Sprint(k)})
+		}
+	}
+
+	return p.String()
+}
+
+func bare(s string) Segment {
+	if s == "*" {
+		return Segment{Kind: Wildcard}
+	}
+
+	if n, err := strconv.Atoi(s); err == nil {
+		return Segment{Kind: Key, Key: s, Index: n, Numeric: true}
+	}
+
+	return Segment{Kind: Key, Key: s}
+}
+
+func parseBracket(s string) (Segment, int, error) {
+	if len(s) > 1 && (s[1] == '"' || s[1] == '\'') {
+		key, n, err := unquote(s[1:])
+		if err != nil {
+			return Segment{}, 0, err
+		}
+
+		if len(s) <= n+1 || s[n+1] != ']' {
+			return Segment{}, 0, errors.New("unterminated bracket")
+		}
+
+		return Segment{Kind: Key, Key: key}, n + 2, nil
+	}
+
+	j := strings.IndexByte(s, ']')
+	if j == -1 {
+		return Segment{}, 0, errors.New("unterminated bracket")
+	}
+
+	switch inner := strings.TrimSpace(s[1:j]); inner {
+	case "*":
+		return Segment{Kind: Wildcard}, j + 1, nil
+	default:
+		n, err := strconv.Atoi(inner)
+		if err != nil {
+			return Segment{}, 0, fmt.Errorf("invalid index %q", inner)
+		}
+
+		return Segment{Kind: Index, Index: n}, j + 1, nil
+	}
+}
+
+func unquote(s string) (string, int, error) {
+	var (
+		q   = s[0]
+		buf strings.Builder
+	)
+
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, errors.New("unterminated quote")
+			}
+
+			i++
+			buf.WriteByte(s[i])
+		case q:
+			return buf.String(), i + 1, nil
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return "", 0, errors.New("unterminated quote")
+}
+
+func quote(key string) string {
+	if key != "" && key != "*" && !strings.ContainsAny(key, `.[]"'\`) {
+		return key
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+}
+
+// Lookup returns all values matching the path, in a deterministic order.
+func Lookup(v any, p Path) []Match {
+	var matches []Match
+
+	walk(v, p, nil, func(q Path, v any) {
+		matches = append(matches, Match{Path: q, Value: v})
+	})
+
+	return matches
+}
+
+func walk(v any, p, q Path, fn func(Path, any)) {
+	if len(p) == 0 {
+		fn(q, v)
+		return
+	}
+
+	seg, rest := p[0], p[1:]
+
+	if seg.Kind == Wildcard {
+		switch v := v.(type) {
+		case map[string]any:
+			for _, k := range keys(v) {
+				walk(v[k], rest, q.Append(Segment{Kind: Key, Key: k}), fn)
+			}
+		case []any:
+			for i, v := range v {
+				walk(v, rest, q.Append(Segment{Kind: Index, Index: i}), fn)
+			}
+		}
+
+		return
+	}
+
+	if w, s, ok := seg.lookup(v); ok {
+		walk(w, rest, q.Append(s), fn)
+	}
+}
+
+func (s Segment) lookup(v any) (any, Segment, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		if s.Kind == Index {
+			return nil, s, false
+		}
+
+		w, ok := v[s.Key]
+
+		return w, Segment{Kind: Key, Key: s.Key}, ok
+	case []any:
+		i, ok := s.index(len(v))
+		if !ok || i >= len(v) {
+			return nil, s, false
+		}
+
+		return v[i], Segment{Kind: Index, Index: i}, true
+	default:
+		return nil, s, false
+	}
+}
+
+func (s Segment) index(n int) (int, bool) {
+	if s.Kind == Key && !s.Numeric {
+		return 0, false
+	}
+
+	i := s.Index
+	if i < 0 {
+		i += n
+	}
+
+	return i, i >= 0
+}
+
+// Set sets x under the path in v, creating intermediate maps when
+// needed, and returns the updated v and whether an existing value was
+// replaced. An index equal to the length of a list appends to it, while
+// other indices out of its range and indexing maps are errors.
+func Set(v any, p Path, x any) (any, bool, error) {
+	if len(p) == 0 {
+		return x, v != nil, nil
+	}
+
+	seg, rest := p[0], p[1:]
+
+	if seg.Kind == Wildcard {
+		var replaced bool
+
+		switch t := v.(type) {
+		case map[string]any:
+			for _, k := range keys(t) {
+				w, _, err := Set(t[k], rest, x)
+				if err != nil {
+					return v, replaced, err
+				}
+
+				t[k], replaced = w, true
+			}
+		case []any:
+			for i := range t {
+				w, _, err := Set(t[i], rest, x)
+				if err != nil {
+					return v, replaced, err
+				}
+
+				t[i], replaced = w, true
+			}
+		}
+
+		return v, replaced, nil
+	}
+
+	switch t := v.(type) {
+	case []any:
+		i, ok := seg.index(len(t))
+
+		switch {
+		case seg.Kind == Key && !seg.Numeric:
+			return v, false, fmt.Errorf("cannot look up key %s in list", seg)
+		case !ok || i > len(t):
+			return v, false, fmt.Errorf("index %s out of range of list of length %d", seg, len(t))
+		case i < len(t):
+			w, replaced, err := Set(t[i], rest, x)
+			if err != nil {
+				return v, false, err
+			}
+
+			t[i] = w
+
+			return t, replaced || len(rest) == 0, nil
+		default:
+			w, _, err := Set(nil, rest, x)
+			if err != nil {
+				return v, false, err
+			}
+
+			return append(t, w), false, nil
+		}
+	case map[string]any:
+		if seg.Kind == Index {
+			return v, false, fmt.Errorf("cannot index map with %s", seg)
+		}
+
+		if t == nil {
+			break
+		}
+
+		w, ok := t[seg.Key]
+
+		if len(rest) == 0 {
+			t[seg.Key] = x
+			return t, ok, nil
+		}
+
+		w, replaced, err := Set(w, rest, x)
+		if err != nil {
+			return v, false, err
+		}
+
+		t[seg.Key] = w
+
+		return t, replaced, nil
+	}
+
+	if seg.Kind == Index {
+		return v, false, fmt.Errorf("index %s out of range of missing list", seg)
+	}
+
+	w, _, err := Set(nil, rest, x)
+	if err != nil {
+		return v, false, err
+	}
+
+	return map[string]any{seg.Key: w}, v != nil && !isNilMap(v), nil
+}
+
+// Delete removes all values matching the path from v and returns the
+// updated v and whether anything was removed.
+func Delete(v any, p Path) (any, bool) {
+	if len(p) == 0 {
+		return v, false
+	}
+
+	seg, rest := p[0], p[1:]
+
+	switch t := v.(type) {
+	case map[string]any:
+		var ks []string
+
+		switch seg.Kind {
+		case Wildcard:
+			ks = keys(t)
+		case Index:
+			return v, false
+		default:
+			if _, ok := t[seg.Key]; !ok {
+				return v, false
+			}
+
+			ks = []string{seg.Key}
+		}
+
+		var deleted bool
+
+		for _, k := range ks {
+			if len(rest) == 0 {
+				delete(t, k)
+				deleted = true
+				continue
+			}
+
+			var ok bool
+
+			if t[k], ok = Delete(t[k], rest); ok {
+				deleted = true
+			}
+		}
+
+		return t, deleted
+	case []any:
+		if seg.Kind == Wildcard {
+			if len(rest) == 0 {
+				return t[:0], len(t) != 0
+			}
+
+			var deleted bool
+
+			for i := range t {
+				var ok bool
+
+				if t[i], ok = Delete(t[i], rest); ok {
+					deleted = true
+				}
+			}
+
+			return t, deleted
+		}
+
+		i, ok := seg.index(len(t))
+		if !ok || i >= len(t) {
+			return v, false
+		}
+
+		if len(rest) == 0 {
+			return append(t[:i], t[i+1:]...), true
+		}
+
+		t[i], ok = Delete(t[i], rest)
+
+		return t, ok
+	default:
+		return v, false
+	}
+}
+
+func keys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func isNilMap(v any) bool {
+	m, ok := v.(map[string]any)
+	return ok && m == nil
+}
+
+// Query evaluates a JSONPath-like expression, e.g. $.labels[*].name,
+// against v. The expression uses the same syntax as Parse with an
+// optional leading $ denoting the root. For expressions containing
+// wildcards the result is a []any of all the matched values.
+func Query(v any, expr string) (any, error) {
+	s := strings.TrimSpace(expr)
+
+	if strings.HasPrefix(s, "$") {
+		s = strings.TrimPrefix(s[1:], ".")
+	}
+
+	if s == "" {
+		return v, nil
+	}
+
+	p, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := Lookup(v, p)
+
+	if p.Wildcard() {
+		list := make([]any, 0, len(matches))
+
+		for _, m := range matches {
+			list = append(list, m.Value)
+		}
+
+		return list, nil
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("query %q: no match", expr)
+	}
+
+	return matches[0].Value, nil
+}
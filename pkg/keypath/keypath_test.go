@@ -0,0 +1,164 @@
+package keypath
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		s    string
+		p    Path
+		norm string
+	}{
+		0: {
+			s: "github.event.number",
+			p: Path{
+				{Kind: Key, Key: "github"},
+				{Kind: Key, Key: "event"},
+				{Kind: Key, Key: "number"},
+			},
+			norm: "github.event.number",
+		},
+		1: {
+			s: "labels.0.name",
+			p: Path{
+				{Kind: Key, Key: "labels"},
+				{Kind: Key, Key: "0", Index: 0, Numeric: true},
+				{Kind: Key, Key: "name"},
+			},
+			norm: "labels.0.name",
+		},
+		2: {
+			s: "labels[-1].name",
+			p: Path{
+				{Kind: Key, Key: "labels"},
+				{Kind: Index, Index: -1},
+				{Kind: Key, Key: "name"},
+			},
+			norm: "labels[-1].name",
+		},
+		3: {
+			s: `metadata.annotations."app.kubernetes.io/name"`,
+			p: Path{
+				{Kind: Key, Key: "metadata"},
+				{Kind: Key, Key: "annotations"},
+				{Kind: Key, Key: "app.kubernetes.io/name"},
+			},
+			norm: `metadata.annotations."app.kubernetes.io/name"`,
+		},
+		4: {
+			s: `labels[*]['a.b']`,
+			p: Path{
+				{Kind: Key, Key: "labels"},
+				{Kind: Wildcard},
+				{Kind: Key, Key: "a.b"},
+			},
+			norm: `labels.*."a.b"`,
+		},
+		5: {
+			s: `a.*."*"."q\"uote"`,
+			p: Path{
+				{Kind: Key, Key: "a"},
+				{Kind: Wildcard},
+				{Kind: Key, Key: "*"},
+				{Kind: Key, Key: `q"uote`},
+			},
+			norm: `a.*."*"."q\"uote"`,
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			p, err := Parse(cas.s)
+			if err != nil {
+				t.Fatalf("%d: Parse()=%+v", i, err)
+			}
+
+			if !cmp.Equal(p, cas.p) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(p, cas.p))
+			}
+
+			if got, want := p.String(), cas.norm; got != want {
+				t.Fatalf("%d: String(): got %q, want %q", i, got, want)
+			}
+		})
+	}
+
+	for _, s := range []string{"", "a..b", "a.", `a."b`, "a[0", "a[x]", `a"b"`} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q): want error", s)
+		}
+	}
+}
+
+func TestLookupSetDelete(t *testing.T) {
+	v := map[string]any{
+		"labels": []any{
+			map[string]any{"name": "bug"},
+			map[string]any{"name": "ci.skip"},
+		},
+		"annotations": map[string]any{
+			"app.kubernetes.io/name": "reflow",
+		},
+	}
+
+	lookup := func(s string) []any {
+		var values []any
+
+		for _, m := range Lookup(v, MustParse(s)) {
+			values = append(values, m.Value)
+		}
+
+		return values
+	}
+
+	cases := []struct {
+		s    string
+		want []any
+	}{
+		0: {"labels.0.name", []any{"bug"}},
+		1: {"labels[-1].name", []any{"ci.skip"}},
+		2: {"labels.*.name", []any{"bug", "ci.skip"}},
+		3: {`annotations."app.kubernetes.io/name"`, []any{"reflow"}},
+		4: {"labels.2.name", nil},
+		5: {"annotations[0]", nil},
+	}
+
+	for i, cas := range cases {
+		if got := lookup(cas.s); !cmp.Equal(got, cas.want) {
+			t.Errorf("%d: got != want:\n%s", i, cmp.Diff(got, cas.want))
+		}
+	}
+
+	if _, ok, err := Set(v, MustParse("labels[-1].name"), "ci"); err != nil || !ok {
+		t.Errorf("Set()=%t, %v: want replaced", ok, err)
+	}
+
+	if _, ok, err := Set(v, MustParse("labels.2.name"), "docs"); err != nil || ok {
+		t.Errorf("Set()=%t, %v: want not replaced", ok, err)
+	}
+
+	for _, s := range []string{"labels.-5", "labels[-5]", "labels[4]", "labels.name", "annotations[0]"} {
+		if _, _, err := Set(v, MustParse(s), "x"); err == nil {
+			t.Errorf("Set(%q): want error", s)
+		}
+	}
+
+	if got, want := lookup("labels[*].name"), []any{"bug", "ci", "docs"}; !cmp.Equal(got, want) {
+		t.Errorf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	if _, ok := Delete(v, MustParse("labels.0")); !ok {
+		t.Errorf("Delete(): want deleted")
+	}
+
+	if _, ok := Delete(v, MustParse("labels.*.name")); !ok {
+		t.Errorf("Delete(): want deleted")
+	}
+
+	if got, want := v["labels"], []any{map[string]any{}, map[string]any{}}; !cmp.Equal(got, want) {
+		t.Errorf("got != want:\n%s", cmp.Diff(got, want))
+	}
+}
@@ -0,0 +1,124 @@
+// Package lazy implements context values, which are computed on first use.
+package lazy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"rafal.dev/reflow/pkg/keypath"
+)
+
+// Value is a memoized thunk. A builder stores it in the context in place
+// of a value, which is expensive to compute and may not be used at all.
+type Value struct {
+	once sync.Once
+	fn   func() (any, error)
+	v    any
+	err  error
+}
+
+func New(fn func() (any, error)) *Value {
+	return &Value{fn: fn}
+}
+
+// Get computes the value on the first call and returns the memoized
+// value and error afterwards.
+func (lv *Value) Get() (any, error) {
+	lv.once.Do(func() {
+		lv.v, lv.err = lv.fn()
+	})
+
+	return lv.v, lv.err
+}
+
+func (lv *Value) MarshalJSON() ([]byte, error) {
+	v, err := Resolve(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+func (lv *Value) MarshalYAML() (any, error) {
+	return Resolve(lv)
+}
+
+// Get returns the value of v if it is lazy, or v otherwise.
+func Get(v any) (any, error) {
+	for {
+		lv, ok := v.(*Value)
+		if !ok {
+			return v, nil
+		}
+
+		var err error
+
+		if v, err = lv.Get(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Resolve returns v with all lazy values resolved, replacing the ones
+// nested in maps and lists in place.
+func Resolve(v any) (any, error) {
+	return resolve(v, nil)
+}
+
+func resolve(v any, path []any) (any, error) {
+	v, err := Get(v)
+	if err != nil {
+		if len(path) != 0 {
+			return nil, fmt.Errorf("%s: %w", keypath.Join(path...), err)
+		}
+
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, w := range v {
+			x, err := resolve(w, append(path[:len(path):len(path)], k))
+			if err != nil {
+				return nil, err
+			}
+
+			v[k] = x
+		}
+	case []any:
+		for i, w := range v {
+			x, err := resolve(w, append(path[:len(path):len(path)], i))
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = x
+		}
+	}
+
+	return v, nil
+}
+
+// Has reports whether v contains any lazy values.
+func Has(v any) bool {
+	switch v := v.(type) {
+	case *Value:
+		return true
+	case map[string]any:
+		for _, v := range v {
+			if Has(v) {
+				return true
+			}
+		}
+	case []any:
+		for _, v := range v {
+			if Has(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
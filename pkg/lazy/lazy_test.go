@@ -0,0 +1,89 @@
+package lazy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValue(t *testing.T) {
+	var calls int
+
+	lv := New(func() (any, error) {
+		calls++
+		return map[string]any{"sha": New(func() (any, error) { return "abc", nil })}, nil
+	})
+
+	m := map[string]any{
+		"reflow": lv,
+		"list":   []any{1, New(func() (any, error) { return 2, nil })},
+	}
+
+	p, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	if got, want := string(p), `{"list":[1,2],"reflow":{"sha":"abc"}}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	v, err := Resolve(m)
+	if err != nil {
+		t.Fatalf("Resolve()=%s", err)
+	}
+
+	want := map[string]any{
+		"reflow": map[string]any{"sha": "abc"},
+		"list":   []any{1, 2},
+	}
+
+	if !cmp.Equal(v, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(v, want))
+	}
+
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+
+	if Has(m) {
+		t.Fatal("Has()=true after Resolve()")
+	}
+}
+
+func TestValueError(t *testing.T) {
+	var (
+		errBoom = errors.New("boom")
+		calls   int
+	)
+
+	m := map[string]any{
+		"reflow": map[string]any{
+			"labels": []any{New(func() (any, error) {
+				calls++
+				return nil, errBoom
+			})},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := Resolve(m)
+		if !errors.Is(err, errBoom) {
+			t.Fatalf("got %v, want %v", err, errBoom)
+		}
+
+		if got, want := err.Error(), "reflow.labels[0]: boom"; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+
+	if !Has(m) {
+		t.Fatal("Has()=false after failed Resolve()")
+	}
+}
@@ -93,11 +93,11 @@ func (b *Builder) Build(ctx context.Context, r io.Reader) error {
 		return fmt.Errorf("building manifest: %w", err)
 	}
 
-	if err := os.WriteFile(valuesFile, []byte(values), 0644); err != nil {
+	if err := b.Fmt.WriteFile(valuesFile, []byte(values)); err != nil {
 		return fmt.Errorf("writing values: %w", err)
 	}
 
-	if err := os.WriteFile(inputsFile, []byte(wrkInputs), 0644); err != nil {
+	if err := b.Fmt.WriteFile(inputsFile, []byte(wrkInputs)); err != nil {
 		return fmt.Errorf("writing inputs: %w", err)
 	}
 
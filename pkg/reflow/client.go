@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -32,6 +33,9 @@ type Client struct {
 	Interval  time.Duration
 	MaxLookup time.Duration
 	token     string
+
+	// Template options to execute templates with, template.Default if nil.
+	Template *template.Options
 }
 
 func New() *Client {
@@ -48,26 +52,21 @@ func New() *Client {
 
 func (cl *Client) Run(ctx context.Context, runID string) (outputs map[string]any, err error) {
 	var (
-		runHome      = filepath.Join(cl.Home, "runs", runID)
-		runContext   = filepath.Join(runHome, "context")
-		runTemplates = filepath.Join(runHome, "templates")
-		runInputs    = filepath.Join(runHome, "inputs", "inputs.yaml")
-		runOutputs   = filepath.Join(runHome, "outputs", "outputs.json")
-
-		home          = cl.Home
-		homeContext   = filepath.Join(home, "context")
-		homeTemplates = filepath.Join(home, "templates")
+		runHome    = filepath.Join(cl.Home, "runs", runID)
+		runInputs  = filepath.Join(runHome, "inputs", "inputs.yaml")
+		runOutputs = filepath.Join(runHome, "outputs", "outputs.json")
 	)
 
-	b := c.SeqBuilder{
-		&c.DirBuilder{Dir: os.DirFS(runContext)},
-		&c.ReflowBuilder{Client: cl.GitHub},
-		&c.DirBuilder{Dir: os.DirFS(homeContext), Exclude: c.Builtin},
-		&c.DirBuilder{Dir: os.DirFS(homeTemplates), Conv: c.Template, Exclude: c.Builtin},
-		&c.DirBuilder{Dir: os.DirFS(runTemplates), Conv: c.Template},
+	m := make(map[string]any)
+
+	if c.ProvenanceFrom(ctx) == nil {
+		ctx = c.WithProvenance(ctx, c.NewProvenance())
 	}
 
-	m := make(map[string]any)
+	b, err := cl.Builder(runID)
+	if err != nil {
+		return nil, fmt.Errorf("building context: %w", err)
+	}
 
 	if err := b.Build(ctx, m); err != nil {
 		return nil, fmt.Errorf("building context: %w", err)
@@ -89,9 +88,11 @@ func (cl *Client) Run(ctx context.Context, runID string) (outputs map[string]any
 		return nil, fmt.Errorf("unmarshal inputs: %w", err)
 	}
 
-	c.Set(m, "reflow.token", cl.token)
+	if _, err := c.Set(m, "reflow.token", cl.token); err != nil {
+		return nil, fmt.Errorf("setting token: %w", err)
+	}
 
-	if err := cl.templateInputs(ctx, inputs, m); err != nil {
+	if err := cl.templateInputs(ctx, runID, inputs, m); err != nil {
 		return nil, fmt.Errorf("template inputs: %w", err)
 	}
 
@@ -270,21 +271,105 @@ poll:
 		return nil, fmt.Errorf("marshal error: %w", err)
 	}
 
-	if err := os.WriteFile(runOutputs, p, 0644); err != nil {
+	if err := cl.Fmt.WriteFile(runOutputs, p); err != nil {
 		return nil, fmt.Errorf("file %q write error: %w", runOutputs, err)
 	}
 
 	return outputs, nil
 }
 
-func (cl *Client) templateInputs(ctx context.Context, inputs, m map[string]any) error {
+// Builder returns the builder of the context of the run. The layers are
+// applied in the following order, each one overriding the previous ones:
+//
+//   - the context of the config repository, of the run and of the home
+//     directory, the latter without the protected keys
+//   - the REFLOW_* environment variables
+//   - git and reflow keys, which may read e.g. git.base set by the above
+//   - outputs of the exec and http builders
+//   - the templates of the config repository, of the home directory
+//     and then of the run
+func (cl *Client) Builder(runID string) (c.SeqBuilder, error) {
+	key, err := cl.Fmt.SecretKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		runHome      = filepath.Join(cl.Home, "runs", runID)
+		runContext   = filepath.Join(runHome, "context")
+		runTemplates = filepath.Join(runHome, "templates")
+
+		home          = cl.Home
+		homeContext   = filepath.Join(home, "context")
+		homeTemplates = filepath.Join(home, "templates")
+		homeSchemas   = filepath.Join(home, "schemas")
+		homeCache     = filepath.Join(home, "cache")
+
+		o = cl.templateOptions()
+	)
+
+	repo := &c.RepoBuilder{Client: cl.GitHub, CacheDir: homeCache, Config: filepath.Join(home, "repo.yaml")}
+
+	return c.SeqBuilder{
+		c.ParBuilder{
+			repo,
+			&c.DirBuilder{Dir: os.DirFS(runContext), Path: runContext, Key: key, Recursive: true},
+			&c.DirBuilder{Dir: os.DirFS(homeContext), Path: homeContext, Exclude: c.Protected, Recursive: true},
+		},
+		&c.EnvBuilder{GitHub: true},
+		&c.GitBuilder{},
+		&c.CacheBuilder{
+			Builder: &c.ReflowBuilder{Client: cl.GitHub},
+			Dir:     homeCache,
+			Keys:    []string{"github", "git.head"},
+		},
+		&c.ExecBuilder{Template: &o},
+		&c.HTTPBuilder{CacheDir: homeCache, Template: &o},
+		repo.Templates(c.TemplateWith(o)),
+		&c.DirBuilder{Dir: os.DirFS(homeTemplates), Path: homeTemplates, Conv: c.TemplateWith(o), Exclude: c.Protected},
+		&c.DirBuilder{Dir: os.DirFS(runTemplates), Path: runTemplates, Conv: c.TemplateWith(cl.sandboxOptions(runID)), Key: key},
+		&c.SchemaBuilder{Dir: os.DirFS(homeSchemas)},
+	}, nil
+}
+
+// templateOptions returns the template options of the client, with the
+// GitHub client and partials read from the home templates directory.
+func (cl *Client) templateOptions() template.Options {
+	o := template.Default
+	if cl.Template != nil {
+		o = *cl.Template
+	}
+	o.GitHub = cl.GitHub
+	o.Partials = []fs.FS{os.DirFS(filepath.Join(cl.Home, "templates", "_partials"))}
+
+	return o
+}
+
+// sandboxOptions returns the template options for the templates and
+// inputs of the run, which come from pull requests, so they are executed
+// with limits and restricted funcs. Partials of the run are available
+// to them only, so they cannot override the ones of trusted templates.
+func (cl *Client) sandboxOptions(runID string) template.Options {
+	o := cl.templateOptions()
+	o.Limits = &template.Sandbox
+	o.Restricted = true
+	o.Partials = append(o.Partials, os.DirFS(filepath.Join(cl.Home, "runs", runID, "templates", "_partials")))
+
+	return o
+}
+
+func (cl *Client) templateInputs(ctx context.Context, runID string, inputs, m map[string]any) error {
 	for k, v := range inputs {
 		var s string
 		if v != nil {
 			s = fmt.Sprint(v)
 		}
 
-		p, err := template.Execute(s, m)
+		o := cl.sandboxOptions(runID)
+		o.Name = "inputs." + k
+		o.Context = ctx
+
+		p, err := o.Execute(s, m)
 		if err != nil {
 			return fmt.Errorf("%s: template error: %w", k, err)
 		}
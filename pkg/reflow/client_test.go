@@ -0,0 +1,85 @@
+package reflow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	c "rafal.dev/reflow/pkg/context"
+	f "rafal.dev/reflow/pkg/fmt"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuilderPrecedence(t *testing.T) {
+	const runID = "d6a3bb3c"
+
+	home := t.TempDir()
+
+	files := map[string]string{
+		"runs/" + runID + "/context/github.json":   `{"event_name": "push", "repository": "rjeczalik/reflow", "ref": "refs/heads/main", "sha": "0850e21"}`,
+		"runs/" + runID + "/context/manifest.yaml": "uses: rjeczalik/reflow/.github/workflows/deploy.yaml@main",
+		"runs/" + runID + "/templates/values.yaml": "replicas: 3\nimage: {pullPolicy: Always}",
+		"context/github.json":                      `{"event_name": "issue_comment"}`,
+		"context/values.yaml":                      "image: {repo: reflow, tag: latest}\nreplicas: 1\nenv: [prod]",
+		"templates/values.yaml":                    "image: {tag: '{{ .reflow.sha }}'}",
+		"templates/manifest.yaml":                  "uses: overridden",
+	}
+
+	for file, content := range files {
+		file = filepath.Join(home, filepath.FromSlash(file))
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("MkdirAll()=%+v", err)
+		}
+
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile()=%+v", err)
+		}
+	}
+
+	t.Setenv("REFLOW_VALUES__IMAGE__REPO", "ghcr.io/reflow")
+
+	cl := &Client{
+		Fmt:  &f.Formater{},
+		Home: home,
+	}
+
+	m := make(map[string]any)
+
+	b, err := cl.Builder(runID)
+	if err != nil {
+		t.Fatalf("Builder()=%+v", err)
+	}
+
+	if err := b.Build(context.Background(), m); err != nil {
+		t.Fatalf("Build()=%+v", err)
+	}
+
+	cases := map[string]any{
+		"github.event_name": "push",
+		"manifest.uses":     "rjeczalik/reflow/.github/workflows/deploy.yaml@main",
+		"reflow.sha":        "0850e21",
+		"values": map[string]any{
+			"image": map[string]any{
+				"repo":       "ghcr.io/reflow",
+				"tag":        "0850e21",
+				"pullPolicy": "Always",
+			},
+			"replicas": 3,
+			"env":      []any{"prod"},
+		},
+	}
+
+	for path, want := range cases {
+		got, err := c.Get[any](m, path)
+		if err != nil {
+			t.Fatalf("Get(%q)=%+v", path, err)
+		}
+
+		if !cmp.Equal(got, want) {
+			t.Fatalf("%s: got != want:\n%s", path, cmp.Diff(got, want))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"rafal.dev/reflow/internal/misc"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const header = "reflow:secretbox:v1\n"
+
+var ErrNoKey = errors.New("no encryption key configured")
+
+var defaultKey struct {
+	once sync.Once
+	key  *Key
+	err  error
+}
+
+// DefaultKey returns the key loaded by LoadKey. The key is loaded on
+// the first call, so a malformed key fails only the commands using it.
+func DefaultKey() (*Key, error) {
+	defaultKey.once.Do(func() {
+		defaultKey.key, defaultKey.err = LoadKey()
+	})
+
+	return defaultKey.key, defaultKey.err
+}
+
+type Key [32]byte
+
+func GenerateKey() (*Key, error) {
+	var k Key
+
+	if _, err := io.ReadFull(rand.Reader, k[:]); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+
+	return &k, nil
+}
+
+func ParseKey(s string) (*Key, error) {
+	var (
+		k Key
+		p []byte
+	)
+
+	s = strings.TrimSpace(s)
+
+	if q, err := base64.StdEncoding.DecodeString(s); err == nil {
+		p = q
+	} else if q, err := hex.DecodeString(s); err == nil {
+		p = q
+	}
+
+	if len(p) != len(k) {
+		return nil, fmt.Errorf("invalid key: want %d bytes encoded as base64 or hex", len(k))
+	}
+
+	copy(k[:], p)
+
+	return &k, nil
+}
+
+func LoadKey() (*Key, error) {
+	if s := os.Getenv("REFLOW_KEY"); s != "" {
+		k, err := ParseKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("REFLOW_KEY: %w", err)
+		}
+
+		return k, nil
+	}
+
+	file := os.Getenv("REFLOW_KEY_FILE")
+	if file == "" {
+		file = filepath.Join(misc.Home(), "key")
+
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+
+	p, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	k, err := ParseKey(string(p))
+	if err != nil {
+		return nil, fmt.Errorf("key file %q: %w", file, err)
+	}
+
+	return k, nil
+}
+
+func (k *Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+func (k *Key) Seal(p []byte) ([]byte, error) {
+	if k == nil {
+		return p, nil
+	}
+
+	var nonce [24]byte
+
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, fmt.Errorf("seal: %w", err)
+	}
+
+	var (
+		box = secretbox.Seal(nonce[:], p, &nonce, (*[32]byte)(k))
+		buf bytes.Buffer
+	)
+
+	buf.WriteString(header)
+	buf.WriteString(base64.StdEncoding.EncodeToString(box))
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func (k *Key) Open(p []byte) ([]byte, error) {
+	if !IsSealed(p) {
+		return p, nil
+	}
+
+	if k == nil {
+		return nil, fmt.Errorf("open: %w", ErrNoKey)
+	}
+
+	box, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(p[len(header):])))
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	if len(box) < 24 {
+		return nil, errors.New("open: ciphertext too short")
+	}
+
+	var nonce [24]byte
+
+	copy(nonce[:], box[:24])
+
+	q, ok := secretbox.Open(nil, box[24:], &nonce, (*[32]byte)(k))
+	if !ok {
+		return nil, errors.New("open: decryption failed")
+	}
+
+	return q, nil
+}
+
+func IsSealed(p []byte) bool {
+	return bytes.HasPrefix(p, []byte(header))
+}
@@ -0,0 +1,127 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSealOpen(t *testing.T) {
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey()=%+v", err)
+	}
+
+	cases := [][]byte{
+		0: []byte(`{"event":{"number":1}}`),
+		1: []byte("multi\nline\n"),
+		2: {},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			p, err := k.Seal(cas)
+			if err != nil {
+				t.Fatalf("%d: Seal()=%+v", i, err)
+			}
+
+			if !IsSealed(p) {
+				t.Fatalf("%d: IsSealed()=false", i)
+			}
+
+			q, err := k.Open(p)
+			if err != nil {
+				t.Fatalf("%d: Open()=%+v", i, err)
+			}
+
+			if got, want := string(q), string(cas); !cmp.Equal(got, want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, want))
+			}
+
+			if _, err := (*Key)(nil).Open(p); err == nil {
+				t.Fatalf("%d: Open() with nil key: want error", i)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey()=%+v", err)
+	}
+
+	q, err := ParseKey(k.String())
+	if err != nil {
+		t.Fatalf("ParseKey()=%+v", err)
+	}
+
+	if *q != *k {
+		t.Fatalf("got %s, want %s", q, k)
+	}
+
+	if _, err := ParseKey("c2hvcnQ="); err == nil {
+		t.Fatal("ParseKey(): want error for short key")
+	}
+}
+
+func TestStore(t *testing.T) {
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey()=%+v", err)
+	}
+
+	s := &Store{Dir: t.TempDir(), Key: k}
+
+	for name, value := range map[string]string{"token": "abc", "password": "xyz"} {
+		if err := s.Set(name, []byte(value)); err != nil {
+			t.Fatalf("Set(%q)=%+v", name, err)
+		}
+
+		p, err := s.Get(name)
+		if err != nil {
+			t.Fatalf("Get(%q)=%+v", name, err)
+		}
+
+		if got, want := string(p), value; got != want {
+			t.Fatalf("Get(%q): got %q, want %q", name, got, want)
+		}
+	}
+
+	names, err := s.List()
+	if err != nil {
+		t.Fatalf("List()=%+v", err)
+	}
+
+	if want := []string{"password", "token"}; !cmp.Equal(names, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(names, want))
+	}
+
+	if err := s.Set("../escape", nil); err == nil {
+		t.Fatal("Set(): want error for invalid name")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey()=%+v", err)
+	}
+
+	t.Setenv("REFLOW_KEY", k.String())
+
+	q, err := LoadKey()
+	if err != nil {
+		t.Fatalf("LoadKey()=%+v", err)
+	}
+
+	if *q != *k {
+		t.Fatalf("got %s, want %s", q, k)
+	}
+
+	t.Setenv("REFLOW_KEY", "malformed")
+
+	if _, err := LoadKey(); err == nil {
+		t.Fatal("LoadKey(): want error for malformed REFLOW_KEY")
+	}
+}
@@ -0,0 +1,103 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"rafal.dev/reflow/internal/misc"
+)
+
+// DefaultStore returns the store of the home directory, which is
+// sealed with the default key.
+func DefaultStore() (*Store, error) {
+	k, err := DefaultKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		Dir: filepath.Join(misc.Home(), "secrets"),
+		Key: k,
+	}, nil
+}
+
+type Store struct {
+	Dir string
+	Key *Key
+}
+
+func (s *Store) Set(name string, value []byte) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+
+	if s.Key == nil {
+		return fmt.Errorf("set %q: %w", name, ErrNoKey)
+	}
+
+	p, err := s.Key.Seal(value)
+	if err != nil {
+		return fmt.Errorf("set %q: %w", name, err)
+	}
+
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return fmt.Errorf("set %q: %w", name, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(s.Dir, name), p, 0600); err != nil {
+		return fmt.Errorf("set %q: %w", name, err)
+	}
+
+	return nil
+}
+
+func (s *Store) Get(name string) ([]byte, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+
+	p, err := os.ReadFile(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("get %q: %w", name, err)
+	}
+
+	if p, err = s.Key.Open(p); err != nil {
+		return nil, fmt.Errorf("get %q: %w", name, err)
+	}
+
+	return p, nil
+}
+
+func (s *Store) List() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list: %w", err)
+	}
+
+	var names []string
+
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid secret name: %q", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package template
+
+import (
+	"text/template"
+
+	"rafal.dev/reflow/pkg/codec"
+	"rafal.dev/reflow/pkg/lazy"
+)
+
+// codecFormats maps names of the to*, mustTo*, from* and mustFrom* funcs,
+// e.g. toToml, to the formats of the codecs they use.
+var codecFormats = map[string]string{
+	"Toml":       "toml",
+	"Dotenv":     "dotenv",
+	"Hcl":        "hcl",
+	"Properties": "properties",
+}
+
+func codecFuncs() template.FuncMap {
+	m := make(template.FuncMap, 4*len(codecFormats))
+
+	for name, format := range codecFormats {
+		format := format
+
+		m["to"+name] = func(v any) string {
+			s, _ := marshal(v, format)
+			return s
+		}
+		m["mustTo"+name] = func(v any) (string, error) {
+			return marshal(v, format)
+		}
+		m["from"+name] = func(s string) any {
+			v, _ := unmarshal(s, format)
+			return v
+		}
+		m["mustFrom"+name] = func(s string) (any, error) {
+			return unmarshal(s, format)
+		}
+	}
+
+	return m
+}
+
+func marshal(v any, format string) (string, error) {
+	v, err := lazy.Resolve(v)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := codec.Marshal(v, format)
+	if err != nil {
+		return "", err
+	}
+
+	return string(p), nil
+}
+
+func unmarshal(s, format string) (v any, err error) {
+	if err := codec.Unmarshal([]byte(s), format, &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
@@ -0,0 +1,69 @@
+package template
+
+import (
+	"testing"
+
+	"rafal.dev/reflow/pkg/lazy"
+)
+
+func TestCodecFuncs(t *testing.T) {
+	v := map[string]any{
+		"app": map[string]any{
+			"name":     "web",
+			"replicas": 3,
+			"message":  "say \"hi\"\nbye",
+		},
+		"tag": lazy.New(func() (any, error) { return "v1", nil }),
+	}
+
+	cases := []struct {
+		tmpl string
+		want string
+	}{
+		0: {
+			tmpl: `{{ toToml .app }}`,
+			want: "message = \"say \\\"hi\\\"\\nbye\"\nname = \"web\"\nreplicas = 3\n",
+		},
+		1: {
+			tmpl: `{{ toDotenv . }}`,
+			want: "APP_MESSAGE='say \"hi\"\nbye'\nAPP_NAME=web\nAPP_REPLICAS=3\nTAG=v1\n",
+		},
+		2: {
+			tmpl: `{{ toProperties .app }}`,
+			want: "message = say \"hi\"\\nbye\nname = web\nreplicas = 3\n",
+		},
+		3: {
+			tmpl: `{{ (toHcl . | fromHcl).app.name }}`,
+			want: "web",
+		},
+		4: {
+			tmpl: `{{ $v := toDotenv .app | mustFromDotenv }}{{ $v.MESSAGE | quote }}`,
+			want: `"say \"hi\"\nbye"`,
+		},
+		5: {
+			tmpl: `{{ (toToml . | fromToml).tag }} {{ (toProperties . | fromProperties).app.replicas }}`,
+			want: "v1 3",
+		},
+		6: {
+			tmpl: `{{ fromToml "= invalid" }}`,
+			want: "<no value>",
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			p, err := Execute(cas.tmpl, v)
+			if err != nil {
+				t.Fatalf("%d: Execute()=%s", i, err)
+			}
+
+			if got, want := string(p), cas.want; got != want {
+				t.Fatalf("%d: got %q, want %q", i, got, want)
+			}
+		})
+	}
+
+	if _, err := Execute(`{{ mustFromToml "= invalid" }}`, nil); err == nil {
+		t.Fatal("want error")
+	}
+}
@@ -0,0 +1,161 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"rafal.dev/reflow/pkg/codec"
+	"rafal.dev/reflow/pkg/lazy"
+)
+
+// EnvOptions configure marshaling of env files and GitHub outputs.
+type EnvOptions struct {
+	// Prefix is prepended to each key.
+	Prefix string `json:"prefix"`
+	// Export prepends export to each env line, so the file can be
+	// sourced by a shell. It is ignored for outputs.
+	Export bool `json:"export"`
+	// Case of the keys, either upper, lower or keep. Env keys are upper
+	// case by default, while output keys are kept as they are.
+	Case string `json:"case"`
+}
+
+// MarshalEnv marshals the map as an env file, which is both a valid
+// dotenv file and a shell script.
+func MarshalEnv(v any, prefix string) ([]byte, error) {
+	return envMarshal(v, EnvOptions{Prefix: prefix})
+}
+
+// envMarshal marshals the map as an env file, see codec.MarshalDotenv.
+func envMarshal(v any, o EnvOptions) ([]byte, error) {
+	env, err := flattenEnv(v, o, "upper")
+	if err != nil {
+		return nil, fmt.Errorf("envMarshal: %w", err)
+	}
+
+	return bytes.TrimSuffix(codec.MarshalDotenv(env, o.Export), []byte("\n")), nil
+}
+
+// githubOutput marshals the map in the format of the $GITHUB_OUTPUT
+// and $GITHUB_ENV files, writing multi-line values with heredoc
+// delimiters, which do not occur in the values.
+func githubOutput(v any, o EnvOptions) ([]byte, error) {
+	outputs, err := flattenEnv(v, o, "keep")
+	if err != nil {
+		return nil, fmt.Errorf("githubOutput: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	for _, e := range outputs {
+		key := outputKey(e.Key)
+
+		if !strings.ContainsAny(e.Value, "\r\n") {
+			fmt.Fprintf(&buf, "%s=%s\n", key, e.Value)
+			continue
+		}
+
+		delim := heredoc(e.Value)
+
+		fmt.Fprintf(&buf, "%s<<%s\n%s\n%s\n", key, delim, e.Value, delim)
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// setOutput marshals the map as the deprecated set-output workflow
+// commands, escaping the values the way GitHub unescapes them.
+func setOutput(v any, o EnvOptions) ([]byte, error) {
+	outputs, err := flattenEnv(v, o, "keep")
+	if err != nil {
+		return nil, fmt.Errorf("setOutput: %w", err)
+	}
+
+	var (
+		buf    bytes.Buffer
+		escape = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	)
+
+	for _, e := range outputs {
+		fmt.Fprintf(&buf, "::set-output name=%s::%s\n", outputKey(e.Key), escape.Replace(e.Value))
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// flattenEnv returns the sorted variables of the map, with the keys
+// prefixed and converted to the case, defaulting to the given one.
+func flattenEnv(v any, o EnvOptions, defaultCase string) ([]codec.EnvVar, error) {
+	v, err := lazy.Resolve(v)
+	if err != nil {
+		return nil, err
+	}
+
+	keyCase := o.Case
+	if keyCase == "" {
+		keyCase = defaultCase
+	}
+
+	var conv func(string) string
+
+	switch keyCase {
+	case "upper":
+		conv = strings.ToUpper
+	case "lower":
+		conv = strings.ToLower
+	case "keep":
+		conv = func(s string) string { return s }
+	default:
+		return nil, fmt.Errorf("invalid case: %q", o.Case)
+	}
+
+	return codec.EnvVars(v, func(k string) string { return o.Prefix + conv(k) })
+}
+
+// outputKey replaces characters not allowed in output names.
+func outputKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+
+		return '_'
+	}, k)
+}
+
+// heredoc returns a delimiter, which is not a line of the value.
+func heredoc(value string) string {
+	lines := make(map[string]bool)
+
+	for _, line := range strings.Split(strings.ReplaceAll(value, "\r\n", "\n"), "\n") {
+		lines[line] = true
+	}
+
+	delim := "EOF"
+
+	for i := 1; lines[delim]; i++ {
+		delim = fmt.Sprintf("EOF_%d", i)
+	}
+
+	return delim
+}
+
+// envOptions converts the options passed to the template funcs,
+// e.g. (dict "export" true), to EnvOptions.
+func envOptions(m map[string]any) (o EnvOptions, err error) {
+	p, err := json.Marshal(m)
+	if err != nil {
+		return o, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&o); err != nil {
+		return o, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return o, nil
+}
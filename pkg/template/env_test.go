@@ -0,0 +1,174 @@
+package template
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var envValues = map[string]any{
+	"git": map[string]any{
+		"head": 123,
+		"ref":  "bar",
+	},
+	"labels":  []any{"bug", "ci.skip"},
+	"message": "it's \"$HOME\"\nEOF\n`echo x`=\\",
+	"empty":   nil,
+	"ratio":   1e6,
+	"ok":      true,
+	"my-key":  "a b",
+}
+
+func TestEnvMarshal(t *testing.T) {
+	cases := []struct {
+		o    EnvOptions
+		m    map[string]any
+		want string
+	}{
+		0: {
+			o:    EnvOptions{Prefix: "REFLOW_"},
+			m:    map[string]any{"GIT": map[string]any{"HEAD": 123, "REF": "bar"}},
+			want: "REFLOW_GIT_HEAD=123\nREFLOW_GIT_REF=bar",
+		},
+		1: {
+			m: envValues,
+			want: "EMPTY=''\nGIT_HEAD=123\nGIT_REF=bar\n" +
+				`LABELS='["bug","ci.skip"]'` + "\n" +
+				`MESSAGE='it'\''s "$HOME"` + "\nEOF\n" + "`echo x`=\\'\n" +
+				"MY_KEY='a b'\nOK=true\nRATIO=1000000",
+		},
+		2: {
+			o:    EnvOptions{Export: true, Case: "lower", Prefix: "X_"},
+			m:    map[string]any{"Git": map[string]any{"Ref": "refs/heads/main"}},
+			want: "export X_git_ref=refs/heads/main",
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			p, err := envMarshal(cas.m, cas.o)
+			if err != nil {
+				t.Fatalf("%d: envMarshal()=%+v", i, err)
+			}
+
+			if got, want := string(p), cas.want; !cmp.Equal(got, want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, want))
+			}
+		})
+	}
+
+	if _, err := envMarshal(envValues, EnvOptions{Case: "title"}); err == nil {
+		t.Fatal("want error")
+	}
+
+	if _, err := envMarshal([]any{1}, EnvOptions{}); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestEnvMarshalShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+
+	p, err := envMarshal(envValues, EnvOptions{Export: true})
+	if err != nil {
+		t.Fatalf("envMarshal()=%+v", err)
+	}
+
+	var (
+		keys   = []string{"MESSAGE", "LABELS", "EMPTY", "MY_KEY"}
+		script = string(p) + "\nprintf '%s\\0'"
+	)
+
+	for _, k := range keys {
+		script += ` "$` + k + `"`
+	}
+
+	out, err := exec.Command(sh, "-c", script).Output()
+	if err != nil {
+		t.Fatalf("sh: %+v", err)
+	}
+
+	got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	want := []string{envValues["message"].(string), `["bug","ci.skip"]`, "", "a b"}
+
+	if !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestGitHubOutput(t *testing.T) {
+	p, err := githubOutput(envValues, EnvOptions{Prefix: "reflow_"})
+	if err != nil {
+		t.Fatalf("githubOutput()=%+v", err)
+	}
+
+	want := "reflow_empty=\nreflow_git_head=123\nreflow_git_ref=bar\n" +
+		`reflow_labels=["bug","ci.skip"]` + "\n" +
+		"reflow_message<<EOF_1\n" + envValues["message"].(string) + "\nEOF_1\n" +
+		"reflow_my-key=a b\nreflow_ok=true\nreflow_ratio=1000000"
+
+	if got := string(p); !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	got := parseOutput(t, string(p))
+
+	for k, v := range map[string]string{
+		"reflow_message": envValues["message"].(string),
+		"reflow_labels":  `["bug","ci.skip"]`,
+		"reflow_my-key":  "a b",
+		"reflow_empty":   "",
+	} {
+		if got[k] != v {
+			t.Fatalf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+// parseOutput parses the $GITHUB_OUTPUT file the way the runner does.
+func TestSetOutput(t *testing.T) {
+	p, err := setOutput(map[string]any{"git": map[string]any{"ref": "bar"}, "msg": "100%\nok"}, EnvOptions{Prefix: "reflow_"})
+	if err != nil {
+		t.Fatalf("setOutput()=%+v", err)
+	}
+
+	want := "::set-output name=reflow_git_ref::bar\n::set-output name=reflow_msg::100%25%0Aok"
+
+	if got := string(p); !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+}
+
+func parseOutput(t *testing.T, s string) map[string]string {
+	var (
+		m     = make(map[string]string)
+		lines = strings.Split(s, "\n")
+	)
+
+	for i := 0; i < len(lines); i++ {
+		if k, delim, ok := strings.Cut(lines[i], "<<"); ok && !strings.Contains(k, "=") {
+			var value []string
+
+			for i++; i < len(lines) && lines[i] != delim; i++ {
+				value = append(value, lines[i])
+			}
+
+			if i == len(lines) {
+				t.Fatalf("%s: missing delimiter %q", k, delim)
+			}
+
+			m[k] = strings.Join(value, "\n")
+			continue
+		}
+
+		k, v, _ := strings.Cut(lines[i], "=")
+		m[k] = v
+	}
+
+	return m
+}
@@ -0,0 +1,230 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FrontMatter configures the execution of a single file. It is read from
+// a YAML block at the beginning of the file, fenced with --- lines, e.g.
+//
+//	---
+//	delims: ["[[", "]]"]
+//	---
+//
+// The block is treated as the front matter only if it sets any of its
+// keys, so files starting with a YAML document separator are not affected.
+type FrontMatter struct {
+	// Delims are the left and right action delimiters.
+	Delims []string `yaml:"delims"`
+	// Expressions set to "keep" leaves GitHub expressions untouched,
+	// while "template" executes them as actions.
+	Expressions string `yaml:"expressions"`
+	// Skip is a template, which makes rendering skip the file
+	// if it evaluates to true, e.g. "{{ not .values.enabled }}".
+	Skip string `yaml:"skip"`
+	// Format is the extension of the format, e.g. json, the rendered
+	// file is converted to.
+	Format string `yaml:"format"`
+}
+
+var frontMatterKeys = []string{"delims", "expressions", "skip", "format"}
+
+// ReadFrontMatter returns the front matter of s, or the zero value
+// if s has none.
+func ReadFrontMatter(s string) (FrontMatter, error) {
+	fm, _, _, err := splitFrontMatter(s)
+	return fm, err
+}
+
+// Extensions maps inner file extensions, e.g. .tmpl of deploy.tmpl.yaml,
+// to the front matter applied before the one of the file itself.
+var Extensions = map[string]FrontMatter{
+	".tmpl": {Expressions: "keep"},
+}
+
+// File returns the options for executing the file, configured by its
+// extension and front matter, and its content without the front matter.
+func (o Options) File(name, s string) (Options, string, error) {
+	if fm, ok := Extensions[path.Ext(strings.TrimSuffix(name, path.Ext(name)))]; ok {
+		if err := o.apply(fm); err != nil {
+			return o, s, err
+		}
+	}
+
+	fm, body, lines, err := splitFrontMatter(s)
+	if err != nil || lines == 0 {
+		return o, s, err
+	}
+
+	if err := o.apply(fm); err != nil {
+		return o, s, err
+	}
+
+	o.offset += lines
+
+	return o, body, nil
+}
+
+func (o *Options) apply(fm FrontMatter) error {
+	switch len(fm.Delims) {
+	case 0:
+	case 2:
+		if fm.Delims[0] == "" || fm.Delims[1] == "" {
+			return fmt.Errorf("front matter: empty delims: %q", fm.Delims)
+		}
+
+		o.Delims = [2]string{fm.Delims[0], fm.Delims[1]}
+	default:
+		return fmt.Errorf("front matter: want left and right delims, got %q", fm.Delims)
+	}
+
+	switch fm.Expressions {
+	case "":
+	case "keep":
+		o.KeepExpressions = true
+	case "template":
+		o.KeepExpressions = false
+	default:
+		return fmt.Errorf("front matter: invalid expressions: %q", fm.Expressions)
+	}
+
+	return nil
+}
+
+// splitFrontMatter returns the front matter of s, its content without
+// the front matter and the number of lines the front matter spans.
+func splitFrontMatter(s string) (fm FrontMatter, body string, lines int, err error) {
+	if !strings.HasPrefix(s, "---\n") {
+		return fm, s, 0, nil
+	}
+
+	block, body, ok := strings.Cut(s[len("---\n"):], "\n---\n")
+	if !ok {
+		if !strings.HasSuffix(s, "\n---") {
+			return fm, s, 0, nil
+		}
+
+		block, body = s[len("---\n"):len(s)-len("\n---")], ""
+	}
+
+	var keys map[string]any
+
+	if yaml.Unmarshal([]byte(block), &keys) != nil {
+		return fm, s, 0, nil
+	}
+
+	if !hasAny(keys, frontMatterKeys) {
+		return fm, s, 0, nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(block)))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&fm); err != nil {
+		return fm, s, 0, fmt.Errorf("front matter: %w", err)
+	}
+
+	return fm, body, strings.Count(block, "\n") + 3, nil
+}
+
+func hasAny(m map[string]any, keys []string) bool {
+	for _, k := range keys {
+		if _, ok := m[k]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// escapeExpressions turns GitHub expressions into actions printing
+// them verbatim, e.g. ${{ github.sha }} into {{ `${{ github.sha }}` }}.
+// Actions are left intact, so expressions in their strings are not
+// escaped.
+func escapeExpressions(s string) string {
+	var buf strings.Builder
+
+	for {
+		i := strings.Index(s, "{{")
+		if i == -1 {
+			break
+		}
+
+		if i == 0 || s[i-1] != '$' {
+			n := actionLen(s[i:])
+			if n == -1 {
+				break
+			}
+
+			buf.WriteString(s[:i+n])
+			s = s[i+n:]
+			continue
+		}
+
+		i--
+
+		j := strings.Index(s[i:], "}}")
+		if j == -1 {
+			break
+		}
+
+		expr := s[i : i+j+len("}}")]
+
+		buf.WriteString(s[:i])
+		buf.WriteString("{{ ")
+
+		// Raw strings keep the line numbers of multi-line expressions.
+		if strings.Contains(expr, "`") {
+			buf.WriteString(strconv.Quote(expr))
+		} else {
+			buf.WriteString("`" + expr + "`")
+		}
+
+		buf.WriteString(" }}")
+
+		s = s[i+len(expr):]
+	}
+
+	buf.WriteString(s)
+
+	return buf.String()
+}
+
+// actionLen returns the length of the action s starts with, skipping
+// the strings, chars and comments in it, or -1 if it is not closed.
+func actionLen(s string) int {
+	for i := len("{{"); i < len(s); i++ {
+		switch c := s[i]; {
+		case strings.HasPrefix(s[i:], "}}"):
+			return i + len("}}")
+		case strings.HasPrefix(s[i:], "/*"):
+			j := strings.Index(s[i+2:], "*/")
+			if j == -1 {
+				return -1
+			}
+
+			i += 2 + j + 1
+		case c == '`':
+			j := strings.IndexByte(s[i+1:], '`')
+			if j == -1 {
+				return -1
+			}
+
+			i += 1 + j
+		case c == '"' || c == '\'':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+
+	return -1
+}
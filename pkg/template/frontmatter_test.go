@@ -0,0 +1,100 @@
+package template
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	v := map[string]any{"sha": "abc"}
+
+	cases := []struct {
+		name string
+		tmpl string
+		want string
+		line int
+	}{
+		0: {
+			name: "deploy.tmpl.yaml",
+			tmpl: "sha: ${{ github.sha }}\nref: {{ .sha }}\nif: ${{\n  github.ref == 'x'\n}}\n",
+			want: "sha: ${{ github.sha }}\nref: abc\nif: ${{\n  github.ref == 'x'\n}}\n",
+		},
+		1: {
+			name: "deploy.yaml",
+			tmpl: "---\nexpressions: keep\n---\nsha: ${{ github.sha }} {{ .sha }}",
+			want: "sha: ${{ github.sha }} abc",
+		},
+		2: {
+			name: "deploy.tmpl.yaml",
+			tmpl: "---\nexpressions: template\n---\nsha: ${{ .sha }}",
+			want: "sha: $abc",
+		},
+		3: {
+			name: "deploy.yaml",
+			tmpl: "---\ndelims: [\"<%\", \"%>\"]\n---\n{{ .sha }} <% .sha %>",
+			want: "{{ .sha }} abc",
+		},
+		4: {
+			name: "deploy.yaml",
+			tmpl: "---\nkey: value\n---\n{{ .sha }}",
+			want: "---\nkey: value\n---\nabc",
+		},
+		5: {
+			name: "deploy.yaml",
+			tmpl: "---\ndelims: [\"[[\", \"]]\"]\n---\nok\n[[ .sha ",
+			line: 5,
+		},
+		6: {
+			name: "deploy.tmpl.yaml",
+			tmpl: "---\ndelims: [\"[[\", \"]]\"]\n---\n${{ x }}\n[[ fail ]]",
+			line: 5,
+		},
+		7: {
+			name: "deploy.tmpl.yaml",
+			tmpl: "run: {{ printf \"${{ %s }}\" .sha }} {{/* ${{ x }} */}}${{ y }} {{ `}}` }}",
+			want: "run: ${{ abc }} ${{ y }} }}",
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			o, s, err := Options{Name: cas.name}.File(cas.name, cas.tmpl)
+			if err != nil {
+				t.Fatalf("%d: File()=%s", i, err)
+			}
+
+			p, err := o.Execute(s, v)
+
+			if cas.line != 0 {
+				var e *Error
+				if !errors.As(err, &e) {
+					t.Fatalf("%d: got %v, want *Error", i, err)
+				}
+
+				if e.Line != cas.line {
+					t.Fatalf("%d: got line %d, want %d", i, e.Line, cas.line)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%d: Execute()=%s", i, err)
+			}
+
+			if got, want := string(p), cas.want; got != want {
+				t.Fatalf("%d: got %q, want %q", i, got, want)
+			}
+		})
+	}
+
+	for _, s := range []string{
+		"---\ndelims: [\"[[\"]\n---\n",
+		"---\nexpressions: drop\n---\n",
+		"---\nexpressions: keep\ndelim: x\n---\n",
+	} {
+		if _, _, err := (Options{}).File("", s); err == nil {
+			t.Fatalf("File(%q): want error", s)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"rafal.dev/reflow/internal/misc"
+	"rafal.dev/reflow/pkg/codec"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-github/v43/github"
+)
+
+// githubFuncs are template funcs querying the GitHub API. They are bound
+// to a single execution, so the responses are memoized for its duration
+// only, and the requests are canceled along with the context.
+//
+// The repository argument, in the owner/repo form, is optional for all
+// but ghFile and defaults to github.repository of the executed context.
+type githubFuncs struct {
+	ctx    context.Context
+	client *github.Client
+	data   any
+	memo   map[string]memoEntry
+}
+
+type memoEntry struct {
+	v   any
+	err error
+}
+
+func newGitHubFuncs(o Options) *githubFuncs {
+	return &githubFuncs{
+		ctx:    o.context(),
+		client: o.GitHub,
+		memo:   make(map[string]memoEntry),
+	}
+}
+
+func (gh *githubFuncs) funcs() template.FuncMap {
+	return template.FuncMap{
+		"ghFile":          gh.file,
+		"ghLatestRelease": gh.latestRelease,
+		"ghTags":          gh.tags,
+		"ghPR":            gh.pr,
+		"ghCommitStatus":  gh.commitStatus,
+	}
+}
+
+// file returns the content of the file, read at the ref if given,
+// or at the default branch otherwise.
+func (gh *githubFuncs) file(repository, file string, ref ...string) (string, error) {
+	v, err := gh.call("ghFile", repository, append([]string{file}, ref...), func(owner, repo string) (any, error) {
+		var opts github.RepositoryContentGetOptions
+		if len(ref) != 0 {
+			opts.Ref = ref[0]
+		}
+
+		fc, _, _, err := gh.github().Repositories.GetContents(gh.ctx, owner, repo, file, &opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if fc == nil {
+			return nil, fmt.Errorf("%q is a directory", file)
+		}
+
+		return fc.GetContent()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return v.(string), nil
+}
+
+func (gh *githubFuncs) latestRelease(repository ...string) (any, error) {
+	return gh.call("ghLatestRelease", first(repository), nil, func(owner, repo string) (any, error) {
+		rel, _, err := gh.github().Repositories.GetLatestRelease(gh.ctx, owner, repo)
+		if err != nil {
+			return nil, err
+		}
+
+		return codec.Generic(rel)
+	})
+}
+
+// tags returns names of all the tags, the semver ones sorted from
+// the latest, followed by the rest in the order returned by the API.
+func (gh *githubFuncs) tags(repository ...string) ([]string, error) {
+	v, err := gh.call("ghTags", first(repository), nil, func(owner, repo string) (any, error) {
+		var (
+			opts = github.ListOptions{PerPage: 100}
+			tags []string
+		)
+
+		for {
+			page, resp, err := gh.github().Repositories.ListTags(gh.ctx, owner, repo, &opts)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, tag := range page {
+				tags = append(tags, tag.GetName())
+			}
+
+			if resp.NextPage == 0 {
+				break
+			}
+
+			opts.Page = resp.NextPage
+		}
+
+		sortTags(tags)
+
+		return tags, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]string), nil
+}
+
+// pr returns the pull request, called either with its number
+// or with the repository and the number.
+func (gh *githubFuncs) pr(args ...any) (any, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("ghPR: want [repository] number, got %d arguments", len(args))
+	}
+
+	num, err := strconv.Atoi(fmt.Sprint(args[len(args)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("ghPR: invalid number: %w", err)
+	}
+
+	var repository string
+	if len(args) == 2 {
+		repository = fmt.Sprint(args[0])
+	}
+
+	return gh.call("ghPR", repository, []string{strconv.Itoa(num)}, func(owner, repo string) (any, error) {
+		pr, _, err := gh.github().PullRequests.Get(gh.ctx, owner, repo, num)
+		if err != nil {
+			return nil, err
+		}
+
+		return codec.Generic(pr)
+	})
+}
+
+// commitStatus returns the combined status of the ref, called either
+// with the ref or with the repository and the ref.
+func (gh *githubFuncs) commitStatus(args ...string) (any, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("ghCommitStatus: want [repository] sha, got %d arguments", len(args))
+	}
+
+	var (
+		repository = first(args[:len(args)-1])
+		ref        = args[len(args)-1]
+	)
+
+	return gh.call("ghCommitStatus", repository, []string{ref}, func(owner, repo string) (any, error) {
+		st, _, err := gh.github().Repositories.GetCombinedStatus(gh.ctx, owner, repo, ref, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return codec.Generic(st)
+	})
+}
+
+// call memoizes the fn, keyed by the name, the repository and the args.
+// An empty repository defaults to the one of the context.
+func (gh *githubFuncs) call(name, repository string, args []string, fn func(owner, repo string) (any, error)) (any, error) {
+	if repository == "" {
+		repository = gh.repository()
+	}
+
+	key := name + " " + repository + " " + strings.Join(args, " ")
+
+	if e, ok := gh.memo[key]; ok {
+		return e.v, e.err
+	}
+
+	owner, repo, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || repo == "" {
+		return nil, fmt.Errorf("%s: invalid repository: %q", name, repository)
+	}
+
+	v, err := fn(owner, repo)
+	if err != nil {
+		err = fmt.Errorf("%s %s: %w", name, repository, err)
+	}
+
+	// Canceled calls are not memoized, as they did not fail on their own.
+	if gh.ctx.Err() == nil {
+		gh.memo[key] = memoEntry{v: v, err: err}
+	}
+
+	return v, err
+}
+
+func (gh *githubFuncs) github() *github.Client {
+	if gh.client == nil {
+		gh.client = misc.GitHub(gh.ctx)
+	}
+
+	return gh.client
+}
+
+func (gh *githubFuncs) repository() string {
+	m, _ := gh.data.(map[string]any)
+	g, _ := m["github"].(map[string]any)
+	s, _ := g["repository"].(string)
+
+	return s
+}
+
+func first(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+
+	return s[0]
+}
+
+func sortTags(tags []string) {
+	versions := make(map[string]*semver.Version, len(tags))
+
+	for _, tag := range tags {
+		if v, err := semver.NewVersion(tag); err == nil {
+			versions[tag] = v
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		vi, vj := versions[tags[i]], versions[tags[j]]
+
+		if vi != nil && vj != nil {
+			return vi.GreaterThan(vj)
+		}
+
+		return vi != nil && vj == nil
+	})
+}
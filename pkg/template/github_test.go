@@ -0,0 +1,124 @@
+package template
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v43/github"
+)
+
+func TestGitHubFuncs(t *testing.T) {
+	requests := make(map[string]int)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/repos/o/r/contents/VERSION":
+			if r.URL.Query().Get("ref") != "v1" {
+				http.NotFound(w, r)
+				return
+			}
+
+			w.Write([]byte(`{"type":"file","encoding":"base64","content":"MS4wLjA="}`))
+		case "/repos/o/r/releases/latest":
+			w.Write([]byte(`{"tag_name":"v1.10.0"}`))
+		case "/repos/o/r/tags":
+			w.Write([]byte(`[{"name":"v1.2.0"},{"name":"latest"},{"name":"v1.10.0"},{"name":"v1.10.0-rc.1"}]`))
+		case "/repos/o/other/pulls/12":
+			w.Write([]byte(`{"number":12,"head":{"ref":"feature"}}`))
+		case "/repos/o/r/pulls/12":
+			w.Write([]byte(`{"number":12,"head":{"ref":"fix"}}`))
+		case "/repos/o/r/commits/abc/status":
+			w.Write([]byte(`{"state":"success"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	v := map[string]any{
+		"github": map[string]any{"repository": "o/r", "sha": "abc"},
+	}
+
+	cases := []struct {
+		tmpl     string
+		want     string
+		requests map[string]int
+	}{
+		0: {
+			tmpl:     `{{ ghFile "o/r" "VERSION" "v1" }}`,
+			want:     "1.0.0",
+			requests: map[string]int{"/repos/o/r/contents/VERSION": 1},
+		},
+		1: {
+			tmpl:     `{{ (ghLatestRelease).tag_name }} {{ (ghLatestRelease "o/r").tag_name }}`,
+			want:     "v1.10.0 v1.10.0",
+			requests: map[string]int{"/repos/o/r/releases/latest": 1},
+		},
+		2: {
+			tmpl:     `{{ ghTags | join "," }} {{ first ghTags }}`,
+			want:     "v1.10.0,v1.10.0-rc.1,v1.2.0,latest v1.10.0",
+			requests: map[string]int{"/repos/o/r/tags": 1},
+		},
+		3: {
+			tmpl: `{{ (ghPR 12).head.ref }} {{ (ghPR "o/other" "12").head.ref }} {{ (ghPR 12).number }}`,
+			want: "fix feature 12",
+			requests: map[string]int{
+				"/repos/o/r/pulls/12":     1,
+				"/repos/o/other/pulls/12": 1,
+			},
+		},
+		4: {
+			tmpl:     `{{ (ghCommitStatus .github.sha).state }}`,
+			want:     "success",
+			requests: map[string]int{"/repos/o/r/commits/abc/status": 1},
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			for k := range requests {
+				delete(requests, k)
+			}
+
+			p, err := Options{GitHub: client}.Execute(cas.tmpl, v)
+			if err != nil {
+				t.Fatalf("%d: Execute()=%s", i, err)
+			}
+
+			if got, want := string(p), cas.want; got != want {
+				t.Fatalf("%d: got %q, want %q", i, got, want)
+			}
+
+			if !cmp.Equal(requests, cas.requests) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(requests, cas.requests))
+			}
+		})
+	}
+
+	t.Run("", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := Options{GitHub: client, Context: ctx}.Execute(`{{ ghPR 12 }}`, v)
+		if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+			t.Fatalf("got %v, want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("", func(t *testing.T) {
+		_, err := Options{GitHub: client}.Execute(`{{ ghTags }}`, nil)
+		if err == nil || !strings.Contains(err.Error(), `invalid repository: ""`) {
+			t.Fatalf("got %v, want invalid repository error", err)
+		}
+	})
+}
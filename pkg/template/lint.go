@@ -0,0 +1,306 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"rafal.dev/reflow/pkg/keypath"
+	"rafal.dev/reflow/pkg/lazy"
+)
+
+// Problem is an issue found by Lint.
+type Problem struct {
+	Name     string
+	Line     int
+	Severity string
+	Message  string
+}
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+func (p Problem) String() string {
+	name := p.Name
+	if name == "" {
+		name = "<template>"
+	}
+
+	return fmt.Sprintf("%s:%d: %s: %s", name, p.Line, p.Severity, p.Message)
+}
+
+// Deprecated funcs along with hints on their replacements.
+var Deprecated = map[string]string{
+	"toOutput":           "the set-output command is deprecated by GitHub, write toGithubOutput to $GITHUB_OUTPUT instead",
+	"mustToOutput":       "the set-output command is deprecated by GitHub, write mustToGithubOutput to $GITHUB_OUTPUT instead",
+	"toOutputPrefix":     "the set-output command is deprecated by GitHub, write toGithubOutputWith (dict \"prefix\" ...) to $GITHUB_OUTPUT instead",
+	"mustToOutputPrefix": "the set-output command is deprecated by GitHub, write mustToGithubOutputWith (dict \"prefix\" ...) to $GITHUB_OUTPUT instead",
+}
+
+// Unknown marks a context value, which content is not known to Lint,
+// e.g. one built from a template, so references under it are not checked.
+var Unknown any = unknown{}
+
+type unknown struct{}
+
+// optionalFuncs are funcs, which arguments may reference missing keys.
+var optionalFuncs = map[string]bool{
+	"default":  true,
+	"empty":    true,
+	"coalesce": true,
+	"hasKey":   true,
+	"ternary":  true,
+	"required": true,
+}
+
+// Lint parses the template and reports syntax errors, references to
+// undefined templates, uses of deprecated funcs and, unless m is nil,
+// references to keys missing in m. Keys referenced in conditions of if,
+// with and range, or passed to funcs like default, are not required.
+func (o Options) Lint(s string, m map[string]any) []Problem {
+	t, _, err := o.parse(s, nil)
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			return []Problem{{Name: e.Name, Line: e.Line, Severity: SeverityError, Message: e.msg}}
+		}
+
+		return []Problem{{Name: o.Name, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	l := &linter{t: t, m: m, name: o.Name, offset: o.offset, deprecated: o.Deprecated}
+
+	if l.deprecated == nil {
+		l.deprecated = Deprecated
+	}
+
+	for _, tt := range t.Templates() {
+		if tt.Tree == nil || tt.Tree.ParseName != o.Name || tt.Tree.Root == nil {
+			continue
+		}
+
+		dot := ref{ok: m != nil && tt.Name() == o.Name}
+
+		l.tree = tt.Tree
+		l.walk(tt.Tree.Root, dot, map[string]ref{"$": dot})
+	}
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		return l.problems[i].Line < l.problems[j].Line
+	})
+
+	return l.problems
+}
+
+// ref is a reference to a context path, if it is known.
+type ref struct {
+	path []string
+	ok   bool
+}
+
+func (r ref) join(keys ...string) ref {
+	if !r.ok {
+		return r
+	}
+
+	return ref{path: append(r.path[:len(r.path):len(r.path)], keys...), ok: true}
+}
+
+type linter struct {
+	t          *template.Template
+	tree       *parse.Tree
+	m          map[string]any
+	name       string
+	offset     int
+	deprecated map[string]string
+	problems   []Problem
+}
+
+func (l *linter) walk(n parse.Node, dot ref, vars map[string]ref) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, n := range n.Nodes {
+			l.walk(n, dot, vars)
+		}
+	case *parse.ActionNode:
+		l.pipe(n.Pipe, dot, vars, false)
+	case *parse.IfNode:
+		l.pipe(n.Pipe, dot, copyVars(vars), true)
+		l.walk(n.List, dot, copyVars(vars))
+		l.walk(n.ElseList, dot, copyVars(vars))
+	case *parse.WithNode:
+		inner := copyVars(vars)
+		l.walk(n.List, l.pipe(n.Pipe, dot, inner, true), inner)
+		l.walk(n.ElseList, dot, copyVars(vars))
+	case *parse.RangeNode:
+		inner := copyVars(vars)
+		l.pipe(n.Pipe, dot, inner, true)
+
+		for _, v := range n.Pipe.Decl {
+			inner[v.Ident[0]] = ref{}
+		}
+
+		l.walk(n.List, ref{}, inner)
+		l.walk(n.ElseList, dot, copyVars(vars))
+	case *parse.TemplateNode:
+		if l.t.Lookup(n.Name) == nil {
+			l.report(n, SeverityError, fmt.Sprintf("undefined template %q", n.Name))
+		}
+
+		if n.Pipe != nil {
+			l.pipe(n.Pipe, dot, vars, false)
+		}
+	}
+}
+
+// pipe checks the pipeline and returns the reference to its value,
+// if it is a plain field or variable.
+func (l *linter) pipe(p *parse.PipeNode, dot ref, vars map[string]ref, optional bool) ref {
+	if p == nil {
+		return ref{}
+	}
+
+	for _, cmd := range p.Cmds {
+		if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && optionalFuncs[id.Ident] {
+			optional = true
+		}
+	}
+
+	var val ref
+
+	for _, cmd := range p.Cmds {
+		for i, arg := range cmd.Args {
+			switch arg := arg.(type) {
+			case *parse.FieldNode:
+				val = dot.join(arg.Ident...)
+			case *parse.VariableNode:
+				val = vars[arg.Ident[0]].join(arg.Ident[1:]...)
+			case *parse.DotNode:
+				val = dot
+			case *parse.PipeNode:
+				val = l.pipe(arg, dot, vars, optional)
+				continue
+			case *parse.ChainNode:
+				if sub, ok := arg.Node.(*parse.PipeNode); ok {
+					l.pipe(sub, dot, vars, optional)
+				}
+
+				val = ref{}
+				continue
+			case *parse.IdentifierNode:
+				l.ident(arg, cmd.Args[i+1:])
+				val = ref{}
+				continue
+			default:
+				val = ref{}
+				continue
+			}
+
+			if !optional {
+				l.check(arg, val)
+			}
+		}
+	}
+
+	if len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		val = ref{}
+	}
+
+	for _, v := range p.Decl {
+		vars[v.Ident[0]] = val
+	}
+
+	return val
+}
+
+func (l *linter) ident(n *parse.IdentifierNode, args []parse.Node) {
+	if hint, ok := l.deprecated[n.Ident]; ok {
+		l.report(n, SeverityWarning, fmt.Sprintf("%s is deprecated: %s", n.Ident, hint))
+	}
+
+	if n.Ident == "include" && len(args) != 0 {
+		if s, ok := args[0].(*parse.StringNode); ok && l.t.Lookup(s.Text) == nil {
+			l.report(n, SeverityError, fmt.Sprintf("undefined template %q", s.Text))
+		}
+	}
+}
+
+// check reports the reference if it points to a missing key.
+func (l *linter) check(n parse.Node, r ref) {
+	if !r.ok {
+		return
+	}
+
+	var cur any = l.m
+
+	for i, k := range r.path {
+		switch v := cur.(type) {
+		case map[string]any:
+			w, ok := v[k]
+			if !ok {
+				l.report(n, SeverityError, fmt.Sprintf("missing key %q", joinPath(r.path[:i+1])))
+				return
+			}
+
+			cur = w
+		case nil, unknown, *lazy.Value:
+			return
+		default:
+			l.report(n, SeverityError, fmt.Sprintf("key %q is %T, not a map", joinPath(r.path[:i]), v))
+			return
+		}
+	}
+}
+
+func (l *linter) report(n parse.Node, severity, msg string) {
+	var (
+		loc, _ = l.tree.ErrorContext(n)
+		line   int
+	)
+
+	// The location is formatted as name:line:col.
+	if v := strings.Split(loc, ":"); len(v) >= 3 {
+		line, _ = strconv.Atoi(v[len(v)-2])
+	}
+
+	if l.tree.ParseName == l.name {
+		line += l.offset
+	}
+
+	l.problems = append(l.problems, Problem{
+		Name:     l.tree.ParseName,
+		Line:     line,
+		Severity: severity,
+		Message:  msg,
+	})
+}
+
+func joinPath(keys []string) string {
+	v := make([]any, len(keys))
+
+	for i, k := range keys {
+		v[i] = k
+	}
+
+	return keypath.Join(v...)
+}
+
+func copyVars(vars map[string]ref) map[string]ref {
+	m := make(map[string]ref, len(vars))
+
+	for k, v := range vars {
+		m[k] = v
+	}
+
+	return m
+}
@@ -0,0 +1,83 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	m := map[string]any{
+		"github": map[string]any{
+			"sha":   "abc",
+			"event": map[string]any{"number": 1},
+		},
+		"deploy": Unknown,
+	}
+
+	cases := []struct {
+		tmpl       string
+		m          map[string]any
+		deprecated map[string]string
+		want       []string
+	}{
+		0: {
+			tmpl: "{{ .github.sha }}\n{{ if .github.shaa",
+			want: []string{"t:2: error: unclosed action"},
+		},
+		1: {
+			tmpl: "{{ .github.sha }}\n{{ .github.shaa }}",
+			m:    m,
+			want: []string{`t:2: error: missing key "github.shaa"`},
+		},
+		2: {
+			tmpl: `{{ if .github.ref }}{{ end }}{{ .github.ref | default "main" }}`,
+			m:    m,
+		},
+		3: {
+			tmpl: "{{ with .github.event }}\n{{ .number }}\n{{ .action }}{{ end }}",
+			m:    m,
+			want: []string{`t:3: error: missing key "github.event.action"`},
+		},
+		4: {
+			tmpl: "{{ $e := .github.event }}{{ $e.number.value }}",
+			m:    m,
+			want: []string{`t:1: error: key "github.event.number" is int, not a map`},
+		},
+		5: {
+			tmpl:       "{{ toYaml .github }}{{ toOutput .github }}",
+			deprecated: map[string]string{"toYaml": "use toJson"},
+			want:       []string{"t:1: warning: toYaml is deprecated: use toJson"},
+		},
+		6: {
+			tmpl: "{{ template \"foo\" . }}\n{{ include \"bar\" . }}",
+			want: []string{`t:1: error: undefined template "foo"`, `t:2: error: undefined template "bar"`},
+		},
+		7: {
+			tmpl: "{{ .deploy.env.name }}{{ range .github.event }}{{ .foo }}{{ end }}",
+			m:    m,
+		},
+		8: {
+			tmpl: "{{ .github.shaa }}",
+		},
+		9: {
+			tmpl: "{{ toOutput .github }}",
+			want: []string{"t:1: warning: toOutput is deprecated: " + Deprecated["toOutput"]},
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			o := Options{Name: "t", Deprecated: cas.deprecated}
+
+			var got []string
+			for _, p := range o.Lint(cas.tmpl, cas.m) {
+				got = append(got, p.String())
+			}
+
+			if !cmp.Equal(got, cas.want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, cas.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Limits bound the resources used by a single execution. Zero values
+// mean no limit, except for MaxDepth, which defaults to 100.
+type Limits struct {
+	// MaxOutput is the maximum number of bytes written, including
+	// the output of include and tpl calls. Values assigned to
+	// variables are not counted until written.
+	MaxOutput int
+	// Timeout is the maximum execution time. It is cooperative: the
+	// deadline is checked on writes and range iterations only, so
+	// it does not interrupt a func call running past it.
+	Timeout time.Duration
+	// MaxDepth is the maximum nesting of include and tpl calls.
+	MaxDepth int
+	// MaxRange is the maximum number of range iterations in total.
+	MaxRange int
+}
+
+// Sandbox are the limits of executing untrusted templates.
+var Sandbox = Limits{
+	MaxOutput: 1 << 20,
+	Timeout:   10 * time.Second,
+	MaxDepth:  10,
+	MaxRange:  10000,
+}
+
+// ErrLimit is returned when an execution exceeds its limits.
+var ErrLimit = errors.New("limit exceeded")
+
+// safeFuncs are the funcs available in the restricted mode. Funcs
+// accessing the network, generating keys and certificates, hashing
+// passwords or allocating memory proportionally to their numeric
+// arguments, e.g. repeat or until, are not listed, so funcs added
+// later are not available until reviewed.
+var safeFuncs = []string{
+	// strings
+	"abbrev", "abbrevboth", "camelcase", "cat", "contains", "hasPrefix",
+	"hasSuffix", "initials", "kebabcase", "lower", "nospace", "plural",
+	"quote", "replace", "snakecase", "split", "splitList", "splitn",
+	"squote", "substr", "swapcase", "title", "toString", "toStrings",
+	"trim", "trimAll", "trimPrefix", "trimSuffix", "trimall", "trunc",
+	"untitle", "upper", "wrap", "wrapWith", "hello",
+	// regexps
+	"regexFind", "regexFindAll", "regexMatch", "regexQuoteMeta",
+	"regexReplaceAll", "regexReplaceAllLiteral", "regexSplit",
+	"mustRegexFind", "mustRegexFindAll", "mustRegexMatch",
+	"mustRegexReplaceAll", "mustRegexReplaceAllLiteral", "mustRegexSplit",
+	// lists
+	"append", "chunk", "compact", "concat", "first", "has", "initial",
+	"last", "list", "prepend", "push", "rest", "reverse", "shuffle",
+	"slice", "sortAlpha", "tuple", "uniq", "without", "mustAppend",
+	"mustChunk", "mustCompact", "mustFirst", "mustHas", "mustInitial",
+	"mustLast", "mustPrepend", "mustPush", "mustRest", "mustReverse",
+	"mustSlice", "mustUniq", "mustWithout",
+	// dicts
+	"deepCopy", "dict", "dig", "get", "hasKey", "keys", "merge",
+	"mergeOverwrite", "omit", "pick", "pluck", "set", "unset", "values",
+	"mustDeepCopy", "mustMerge", "mustMergeOverwrite",
+	// math
+	"add", "add1", "add1f", "addf", "atoi", "biggest", "ceil", "div",
+	"divf", "float64", "floor", "int", "int64", "max", "maxf", "min",
+	"minf", "mod", "mul", "mulf", "randInt", "round", "sub", "subf",
+	"toDecimal",
+	// encodings and hashes
+	"adler32sum", "b32dec", "b32enc", "b64dec", "b64enc", "sha1sum",
+	"sha256sum",
+	// formats
+	"fromDotenv", "fromHcl", "fromJson", "fromProperties", "fromToml",
+	"fromYaml", "mustFromDotenv", "mustFromHcl", "mustFromJson",
+	"mustFromProperties", "mustFromToml", "mustFromYaml", "toDotenv",
+	"toEnv", "toEnvPrefix", "toEnvWith", "toGithubOutput",
+	"toGithubOutputWith", "toHcl", "toJson", "toOutput", "toOutputPrefix",
+	"toPrettyJson", "toProperties", "toRawJson", "toToml", "toYaml",
+	"mustToDotenv", "mustToEnv", "mustToEnvPrefix", "mustToEnvWith",
+	"mustToGithubOutput", "mustToGithubOutputWith", "mustToHcl",
+	"mustToJson", "mustToOutput", "mustToOutputPrefix", "mustToPrettyJson",
+	"mustToProperties", "mustToRawJson", "mustToToml", "mustToYaml",
+	"query", "mustQuery",
+	// paths and urls
+	"base", "clean", "dir", "ext", "isAbs", "osBase", "osClean", "osDir",
+	"osExt", "osIsAbs", "urlJoin", "urlParse",
+	// dates and versions
+	"ago", "duration", "durationRound", "mustDateModify", "mustToDate",
+	"must_date_modify", "toDate", "unixEpoch", "semver", "semverCompare",
+	// flow and types
+	"all", "any", "coalesce", "default", "deepEqual", "empty", "error",
+	"fail", "kindIs", "kindOf", "ternary", "typeIs", "typeIsLike",
+	"typeOf",
+}
+
+// maxWidth caps the widths of the funcs padding their output in the
+// restricted mode, as the padding is allocated before it is written.
+const maxWidth = 1024
+
+// cappedFuncs replace the funcs and builtins of the same names in the
+// restricted mode.
+var cappedFuncs = template.FuncMap{
+	"indent": func(n int, s string) (string, error) {
+		if n > maxWidth {
+			return "", fmt.Errorf("indent width exceeds %d: %w", maxWidth, ErrLimit)
+		}
+
+		return globalFuncs["indent"].(func(int, string) string)(n, s), nil
+	},
+	"nindent": func(n int, s string) (string, error) {
+		if n > maxWidth {
+			return "", fmt.Errorf("nindent width exceeds %d: %w", maxWidth, ErrLimit)
+		}
+
+		return globalFuncs["nindent"].(func(int, string) string)(n, s), nil
+	},
+	"printf": func(format string, args ...any) (string, error) {
+		if err := checkWidths(format); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf(format, args...), nil
+	},
+}
+
+var restrictedFuncs = restrict(globalFuncs)
+
+func restrict(funcs template.FuncMap) template.FuncMap {
+	m := make(template.FuncMap, len(safeFuncs)+len(cappedFuncs))
+
+	for _, k := range safeFuncs {
+		if v, ok := funcs[k]; ok {
+			m[k] = v
+		}
+	}
+
+	for k, v := range cappedFuncs {
+		m[k] = v
+	}
+
+	return m
+}
+
+// checkWidths fails if any verb of the printf format has the width or
+// precision exceeding maxWidth, or passed as an argument.
+func checkWidths(format string) error {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+
+		for i++; i < len(format) && strings.IndexByte("+-# 0", format[i]) != -1; i++ {
+		}
+
+		for n := 0; i < len(format); i++ {
+			switch c := format[i]; {
+			case c == '*':
+				return fmt.Errorf("printf: width arguments are not allowed: %w", ErrLimit)
+			case c >= '0' && c <= '9':
+				if n = 10*n + int(c-'0'); n > maxWidth {
+					return fmt.Errorf("printf: width exceeds %d: %w", maxWidth, ErrLimit)
+				}
+
+				continue
+			case c == '.' || c == '[' || c == ']':
+				n = 0
+				continue
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
+
+// rangeFunc is appended to the pipelines of range actions,
+// when the range iterations are limited.
+const rangeFunc = "__range"
+
+// execution tracks the resources used by a single execution.
+type execution struct {
+	ctx    context.Context
+	limits Limits
+	output int
+	ranges int
+}
+
+func (e *execution) depth() int {
+	if e.limits.MaxDepth > 0 {
+		return e.limits.MaxDepth
+	}
+
+	return maxIncludeDepth
+}
+
+func (e *execution) write(n int) error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+
+	if e.limits.MaxOutput > 0 && e.output+n > e.limits.MaxOutput {
+		return fmt.Errorf("output exceeds %d bytes: %w", e.limits.MaxOutput, ErrLimit)
+	}
+
+	e.output += n
+
+	return nil
+}
+
+// iterate counts the iterations over v.
+func (e *execution) iterate(v any) (any, error) {
+	if err := e.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		e.ranges += rv.Len()
+	}
+
+	if e.limits.MaxRange > 0 && e.ranges > e.limits.MaxRange {
+		return nil, fmt.Errorf("range iterations exceed %d: %w", e.limits.MaxRange, ErrLimit)
+	}
+
+	return v, nil
+}
+
+func (e *execution) writer(w io.Writer) io.Writer {
+	return &limitWriter{w: w, e: e}
+}
+
+type limitWriter struct {
+	w io.Writer
+	e *execution
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if err := lw.e.write(len(p)); err != nil {
+		return 0, err
+	}
+
+	return lw.w.Write(p)
+}
+
+// limitRanges appends the range func to the pipelines of the range
+// actions of the templates, so their iterations are counted.
+func limitRanges(seen map[*parse.Tree]bool, templates ...*template.Template) {
+	for _, t := range templates {
+		if t.Tree == nil || seen[t.Tree] {
+			continue
+		}
+
+		seen[t.Tree] = true
+
+		walk(t.Tree.Root, func(n parse.Node) {
+			r, ok := n.(*parse.RangeNode)
+			if !ok {
+				return
+			}
+
+			r.Pipe.Cmds = append(r.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      r.Pipe.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(rangeFunc).SetTree(t.Tree).SetPos(r.Pipe.Pos)},
+			})
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestExecuteLimits(t *testing.T) {
+	v := map[string]any{
+		"items": []any{1, 2, 3},
+		"big":   strings.Repeat("x", 100),
+	}
+
+	partials := fstest.MapFS{
+		"loop.tpl":  {Data: []byte(`{{ include "loop" . }}`)},
+		"items.tpl": {Data: []byte(`{{ range .items }}{{ . }}{{ end }}`)},
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		tmpl   string
+		limits Limits
+		ctx    context.Context
+		want   string
+		err    error
+	}{
+		0: {
+			tmpl:   `{{ range .items }}{{ . }}{{ end }}{{ range .items }}{{ . }}{{ end }}`,
+			limits: Limits{MaxRange: 6},
+			want:   "123123",
+		},
+		1: {
+			tmpl:   `{{ range .items }}{{ range $.items }}{{ . }}{{ end }}{{ end }}`,
+			limits: Limits{MaxRange: 6},
+			err:    ErrLimit,
+		},
+		2: {
+			tmpl:   `{{ include "items" . }}{{ tpl "{{ range .items }}{{ end }}" . }}`,
+			limits: Limits{MaxRange: 5},
+			err:    ErrLimit,
+		},
+		3: {
+			tmpl:   `{{ .big }}`,
+			limits: Limits{MaxOutput: 100},
+			want:   v["big"].(string),
+		},
+		4: {
+			tmpl:   `{{ .big }}!`,
+			limits: Limits{MaxOutput: 100},
+			err:    ErrLimit,
+		},
+		5: {
+			tmpl:   `{{ $x := include "items" . }}{{ $y := include "items" . }}`,
+			limits: Limits{MaxOutput: 5},
+			err:    ErrLimit,
+		},
+		6: {
+			tmpl:   `{{ include "loop" . }}`,
+			limits: Limits{MaxDepth: 10},
+			err:    ErrLimit,
+		},
+		7: {
+			tmpl:   `{{ range .items }}{{ . }}{{ end }}`,
+			limits: Limits{Timeout: time.Minute},
+			ctx:    canceled,
+			err:    context.Canceled,
+		},
+		8: {
+			tmpl: `{{ mustJq "[range(1e9)]" . }}`,
+			ctx:  canceled,
+			err:  context.Canceled,
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			o := Options{Limits: &cas.limits, Context: cas.ctx, Partials: []fs.FS{partials}}
+
+			p, err := o.Execute(cas.tmpl, v)
+
+			if cas.err != nil {
+				if !errors.Is(err, cas.err) {
+					t.Fatalf("%d: got %v, want %v", i, err, cas.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%d: Execute()=%s", i, err)
+			}
+
+			if got, want := string(p), cas.want; got != want {
+				t.Fatalf("%d: got %q, want %q", i, got, want)
+			}
+		})
+	}
+}
+
+func TestExecuteRestricted(t *testing.T) {
+	for i, tmpl := range []string{
+		`{{ ghPR 1 }}`,
+		`{{ repeat 1000000000 "x" }}`,
+		`{{ jq "range(1e9)" . }}`,
+		`{{ genPrivateKey "rsa" }}`,
+		`{{ bcrypt "x" }}`,
+		`{{ htpasswd "user" "x" }}`,
+	} {
+		if _, err := (Options{Restricted: true}).Execute(tmpl, nil); err == nil || !strings.Contains(err.Error(), "not defined") {
+			t.Fatalf("%d: got %v, want undefined function error", i, err)
+		}
+	}
+
+	for i, tmpl := range []string{
+		`{{ $x := indent 300000000 "a" }}`,
+		`{{ nindent 2000 "a" }}`,
+		`{{ printf "%0300000000d" 1 }}`,
+		`{{ printf "%.2000f" 1.0 }}`,
+		`{{ printf "%*d" 300000000 1 }}`,
+	} {
+		if _, err := (Options{Restricted: true}).Execute(tmpl, nil); !errors.Is(err, ErrLimit) {
+			t.Fatalf("%d: got %v, want %v", i, err, ErrLimit)
+		}
+	}
+
+	p, err := Options{Restricted: true}.Execute(`{{ "a" | upper }}{{ "b" | nindent 2 }} {{ printf "%-3s|%5.1f|%[1]q|%%" "c" 1.25 }}`, nil)
+	if err != nil {
+		t.Fatalf("Execute()=%s", err)
+	}
+
+	if got, want := string(p), "A\n  b c  |  1.2|\"c\"|%"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	for _, k := range safeFuncs {
+		if _, ok := globalFuncs[k]; !ok {
+			t.Errorf("safe func %q is not defined", k)
+		}
+	}
+}
@@ -2,21 +2,35 @@ package template
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
+	"text/template/parse"
 
-	"rafal.dev/refmt/object"
+	"rafal.dev/reflow/pkg/jq"
+	"rafal.dev/reflow/pkg/keypath"
+	"rafal.dev/reflow/pkg/lazy"
 
 	"github.com/Masterminds/sprig/v3"
+	"github.com/google/go-github/v43/github"
 	"gopkg.in/yaml.v3"
 )
 
 var globalFuncs = FuncMap()
 
+// FuncMap returns the funcs available to all templates. The gh* funcs
+// querying the GitHub API and the jq funcs are not included, as they
+// are bound to each execution by Execute.
 func FuncMap() template.FuncMap {
-	return merge(sprig.HermeticTxtFuncMap(),
+	return merge(merge(sprig.HermeticTxtFuncMap(), codecFuncs()),
 		map[string]any{
 			"toYaml": func(v any) string {
 				p, _ := yaml.Marshal(v)
@@ -40,49 +54,99 @@ func FuncMap() template.FuncMap {
 				return v, nil
 			},
 			"toEnv": func(v any) string {
-				p, _ := envMarshal(v, "")
+				p, _ := envMarshal(v, EnvOptions{})
 				return string(p)
 			},
 			"mustToEnv": func(v any) (string, error) {
-				p, err := envMarshal(v, "")
+				p, err := envMarshal(v, EnvOptions{})
 				if err != nil {
 					return "", err
 				}
 				return string(p), nil
 			},
 			"toEnvPrefix": func(prefix string, v any) string {
-				p, _ := envMarshal(v, prefix)
+				p, _ := envMarshal(v, EnvOptions{Prefix: prefix})
 				return string(p)
 			},
 			"mustToEnvPrefix": func(prefix string, v any) (string, error) {
-				p, err := envMarshal(v, prefix)
+				p, err := envMarshal(v, EnvOptions{Prefix: prefix})
+				if err != nil {
+					return "", err
+				}
+				return string(p), nil
+			},
+			"toEnvWith": func(opts map[string]any, v any) string {
+				o, _ := envOptions(opts)
+				p, _ := envMarshal(v, o)
+				return string(p)
+			},
+			"mustToEnvWith": func(opts map[string]any, v any) (string, error) {
+				o, err := envOptions(opts)
+				if err != nil {
+					return "", err
+				}
+				p, err := envMarshal(v, o)
 				if err != nil {
 					return "", err
 				}
 				return string(p), nil
 			},
 			"toOutput": func(v any) string {
-				p, _ := githubOutput(v, "")
+				p, _ := setOutput(v, EnvOptions{})
 				return string(p)
 			},
 			"mustToOutput": func(v any) (string, error) {
-				p, err := githubOutput(v, "")
+				p, err := setOutput(v, EnvOptions{})
 				if err != nil {
 					return "", err
 				}
 				return string(p), nil
 			},
 			"toOutputPrefix": func(prefix string, v any) string {
-				p, _ := githubOutput(v, prefix)
+				p, _ := setOutput(v, EnvOptions{Prefix: prefix})
 				return string(p)
 			},
 			"mustToOutputPrefix": func(prefix string, v any) (string, error) {
-				p, err := githubOutput(v, prefix)
+				p, err := setOutput(v, EnvOptions{Prefix: prefix})
+				if err != nil {
+					return "", err
+				}
+				return string(p), nil
+			},
+			"toGithubOutput": func(v any) string {
+				p, _ := githubOutput(v, EnvOptions{})
+				return string(p)
+			},
+			"mustToGithubOutput": func(v any) (string, error) {
+				p, err := githubOutput(v, EnvOptions{})
 				if err != nil {
 					return "", err
 				}
 				return string(p), nil
 			},
+			"toGithubOutputWith": func(opts map[string]any, v any) string {
+				o, _ := envOptions(opts)
+				p, _ := githubOutput(v, o)
+				return string(p)
+			},
+			"mustToGithubOutputWith": func(opts map[string]any, v any) (string, error) {
+				o, err := envOptions(opts)
+				if err != nil {
+					return "", err
+				}
+				p, err := githubOutput(v, o)
+				if err != nil {
+					return "", err
+				}
+				return string(p), nil
+			},
+			"query": func(expr string, v any) any {
+				x, _ := keypath.Query(v, expr)
+				return x
+			},
+			"mustQuery": func(expr string, v any) (any, error) {
+				return keypath.Query(v, expr)
+			},
 			"error": func(s string) error {
 				return errors.New(s)
 			},
@@ -90,58 +154,568 @@ func FuncMap() template.FuncMap {
 	)
 }
 
+// Default options used by Execute and ExecuteNamed. Strict is enabled
+// with REFLOW_STRICT=1. Commands use a copy, see command.App.
+var Default = Options{
+	Strict: parseBool(os.Getenv("REFLOW_STRICT")),
+}
+
+// Options configure template execution.
+type Options struct {
+	// Name of the template, usually its file, used in error messages.
+	Name string
+	// Strict makes referencing a missing key an error,
+	// instead of rendering "<no value>".
+	Strict bool
+	// Partials are directories of named templates, which can be
+	// executed with template or include, e.g. labels.tpl is named
+	// "labels". Partials in later directories override earlier ones.
+	Partials []fs.FS
+	// Context and GitHub are used by the GitHub funcs, like ghPR.
+	// If GitHub is nil, a client is created with the GITHUB_TOKEN.
+	Context context.Context
+	GitHub  *github.Client
+	// Delims are the left and right action delimiters,
+	// "{{" and "}}" if empty.
+	Delims [2]string
+	// KeepExpressions leaves GitHub expressions, like ${{ github.sha }},
+	// untouched instead of executing them as actions.
+	KeepExpressions bool
+	// Deprecated funcs reported by Lint, the package Deprecated if nil.
+	Deprecated map[string]string
+	// Limits, if set, bound the resources used by the execution.
+	Limits *Limits
+	// Restricted allows only the funcs safe for executing untrusted
+	// templates, e.g. ones not accessing the network or allocating
+	// memory proportionally to their arguments.
+	Restricted bool
+
+	// offset is the number of lines of the stripped front matter.
+	offset int
+}
+
+// maxIncludeDepth limits nesting of include and tpl calls,
+// so recursive partials fail instead of overflowing the stack.
+const maxIncludeDepth = 100
+
 func Execute(s string, v any) ([]byte, error) {
-	t, err := template.New("").Funcs(globalFuncs).Parse(s)
+	return ExecuteNamed("", s, v)
+}
+
+// ExecuteNamed executes the template with the default options,
+// naming it in error messages.
+func ExecuteNamed(name, s string, v any) ([]byte, error) {
+	o := Default
+	o.Name = name
+
+	return o.Execute(s, v)
+}
+
+func (o Options) Execute(s string, v any) ([]byte, error) {
+	if o.Limits != nil && o.Limits.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(o.context(), o.Limits.Timeout)
+		defer cancel()
+
+		o.Context = ctx
+	}
+
+	t, ex, err := o.parse(s, v)
 	if err != nil {
 		return nil, fmt.Errorf("template parse error: %w", err)
 	}
 
+	if err := resolveLazy(t, v); err != nil {
+		return nil, fmt.Errorf("template execute error: %w", err)
+	}
+
 	var buf bytes.Buffer
 
-	if err := t.Execute(&buf, v); err != nil {
-		return nil, fmt.Errorf("template execute error: %w", err)
+	if err := t.Execute(ex.writer(&buf), v); err != nil {
+		return nil, fmt.Errorf("template execute error: %w", o.locate(err))
 	}
 
 	return buf.Bytes(), nil
 }
 
-func envMarshal(v any, prefix string) ([]byte, error) {
-	m, ok := v.(map[string]any)
-	if !ok {
-		return nil, errors.New("envMarshal: cannot marshal non-object value")
-	}
-
+// parse parses the template, with the GitHub funcs bound
+// to the data it is going to be executed with, and returns
+// the execution tracking its resources.
+func (o Options) parse(s string, data any) (*template.Template, *execution, error) {
 	var (
-		envs = object.Flatten(m, "_")
-		keys = object.Keys(envs)
-		buf  bytes.Buffer
+		t     = template.New(o.Name)
+		gh    = newGitHubFuncs(o)
+		ex    = &execution{ctx: o.context()}
+		seen  = make(map[*parse.Tree]bool)
+		depth int
 	)
 
+	gh.data = data
+
+	if o.Limits != nil {
+		ex.limits = *o.Limits
+	}
+
+	if o.Restricted {
+		t.Funcs(restrictedFuncs)
+	} else {
+		t.Funcs(globalFuncs).Funcs(gh.funcs()).Funcs(jqFuncs(ex.ctx))
+	}
+
+	if o.Strict {
+		t = t.Option("missingkey=error").Funcs(strictFuncs)
+	}
+
+	t.Delims(o.Delims[0], o.Delims[1])
+
+	t.Funcs(template.FuncMap{
+		"include": func(name string, data any) (string, error) {
+			if depth >= ex.depth() {
+				return "", fmt.Errorf("include %q: maximum depth of %d exceeded: %w", name, ex.depth(), ErrLimit)
+			}
+
+			depth++
+			defer func() { depth-- }()
+
+			var buf strings.Builder
+
+			if err := t.ExecuteTemplate(ex.writer(&buf), name, data); err != nil {
+				return "", err
+			}
+
+			return buf.String(), nil
+		},
+		"tpl": func(s string, data any) (string, error) {
+			if depth >= ex.depth() {
+				return "", fmt.Errorf("tpl: maximum depth of %d exceeded: %w", ex.depth(), ErrLimit)
+			}
+
+			depth++
+			defer func() { depth-- }()
+
+			c, err := t.Clone()
+			if err != nil {
+				return "", err
+			}
+
+			if c, err = c.New("tpl").Parse(o.escape(s)); err != nil {
+				return "", err
+			}
+
+			if o.Limits != nil {
+				limitRanges(seen, c)
+			}
+
+			if err := resolveLazy(c, data); err != nil {
+				return "", err
+			}
+
+			var buf strings.Builder
+
+			if err := c.Execute(ex.writer(&buf), data); err != nil {
+				return "", err
+			}
+
+			return buf.String(), nil
+		},
+		rangeFunc: ex.iterate,
+	})
+
+	for _, dir := range o.Partials {
+		if err := o.parsePartials(t, dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if _, err := t.Parse(o.escape(s)); err != nil {
+		return nil, nil, o.locate(err)
+	}
+
+	if o.Limits != nil {
+		limitRanges(seen, t.Templates()...)
+	}
+
+	return t, ex, nil
+}
+
+func (o Options) context() context.Context {
+	if o.Context != nil {
+		return o.Context
+	}
+
+	return context.Background()
+}
+
+// parsePartials parses all the files found in the dir as templates
+// named after the files, without their extensions. Each partial is
+// configured by its own extension and front matter, not by the options
+// of the template including it.
+func (o Options) parsePartials(t *template.Template, dir fs.FS) error {
+	err := fs.WalkDir(dir, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		p, err := fs.ReadFile(dir, file)
+		if err != nil {
+			return err
+		}
+
+		// The partial is parsed under its file name, so errors
+		// refer to the file, and aliased under the short name.
+		name := path.Join("_partials", file)
+
+		o, s, err := Options{Name: name}.File(name, string(p))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		pt, err := t.New(name).Delims(o.Delims[0], o.Delims[1]).Parse(o.escape(s))
+		if err != nil {
+			return o.locate(err)
+		}
+
+		if _, err := t.AddParseTree(strings.TrimSuffix(file, path.Ext(file)), pt.Tree); err != nil {
+			return o.locate(err)
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// escape escapes GitHub expressions if they are kept and would
+// otherwise be parsed as actions.
+func (o Options) escape(s string) string {
+	if !o.KeepExpressions || (o.Delims[0] != "" && o.Delims[0] != "{{") {
+		return s
+	}
+
+	return escapeExpressions(s)
+}
+
+func parseBool(s string) bool {
+	ok, _ := strconv.ParseBool(s)
+	return ok
+}
+
+// Error is a template error along with its location.
+type Error struct {
+	Name string
+	Line int
+	// Path of the missing key, set in strict mode only.
+	Path string
+	Err  error
+
+	msg string
+}
+
+func (e *Error) Error() string {
+	name := e.Name
+	if name == "" {
+		name = "<template>"
+	}
+
+	if e.Path != "" {
+		return fmt.Sprintf("%s:%d: missing key %q", name, e.Line, e.Path)
+	}
+
+	return fmt.Sprintf("%s:%d: %s", name, e.Line, e.msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	execErrorRe  = regexp.MustCompile(`(?s)^template: (.*?):(\d+):\d+: executing ".*?" at <(.*?)>: (.*)$`)
+	parseErrorRe = regexp.MustCompile(`(?s)^template: (.*?):(\d+): (.*)$`)
+	missingKeyRe = regexp.MustCompile(`^(?:error calling index: )?(?:map has no entry for key "(.*)"|nil pointer evaluating .*\.(\w+))$`)
+)
+
+// locate converts text/template errors, which are reported as formatted
+// strings only, into an *Error.
+func (o Options) locate(err error) error {
+	if v := execErrorRe.FindStringSubmatch(err.Error()); v != nil {
+		// Errors of included templates are reported at their location.
+		if i := strings.Index(v[4], "template: "); i != -1 && strings.HasPrefix(v[4], "error calling ") {
+			if e, ok := o.locate(errors.New(v[4][i:])).(*Error); ok {
+				e.Err = err
+				return e
+			}
+		}
+
+		line, _ := strconv.Atoi(v[2])
+
+		if v[1] == o.Name {
+			line += o.offset
+		}
+
+		// The range func is internal, so it is not mentioned.
+		e := &Error{Name: v[1], Line: line, Err: err, msg: strings.TrimPrefix(v[4], "error calling "+rangeFunc+": ")}
+
+		if m := missingKeyRe.FindStringSubmatch(v[4]); m != nil && o.Strict {
+			e.Path = missingPath(v[3], m[1]+m[2])
+		}
+
+		return e
+	}
+
+	if v := parseErrorRe.FindStringSubmatch(err.Error()); v != nil {
+		line, _ := strconv.Atoi(v[2])
+
+		return &Error{Name: o.Name, Line: line + o.offset, Err: err, msg: v[3]}
+	}
+
+	return err
+}
+
+// missingPath returns the path of the missing key from the expression
+// which referenced it, either a field chain or a call to index.
+func missingPath(expr, key string) string {
+	if strings.HasPrefix(expr, ".") || strings.HasPrefix(expr, "$") {
+		keys := strings.Split(strings.TrimPrefix(strings.TrimPrefix(expr, "$"), "."), ".")
+
+		for i, k := range keys {
+			if k == key {
+				keys = keys[:i+1]
+				break
+			}
+		}
+
+		path := strings.Join(keys, ".")
+
+		if strings.HasPrefix(expr, "$") && !strings.HasPrefix(expr, "$.") {
+			path = "$" + path
+		}
+
+		return path
+	}
+
+	args := strings.Fields(expr)
+	if len(args) < 3 || args[0] != "index" {
+		return key
+	}
+
+	var keys []any
+
+	if s := missingPath(args[1], ""); s != "" && s != "." {
+		keys = append(keys, s)
+	}
+
+	for _, arg := range args[2:] {
+		s, err := strconv.Unquote(arg)
+		if err != nil {
+			s = arg
+		}
+
+		keys = append(keys, s)
+
+		if s == key {
+			break
+		}
+	}
+
+	return keypath.Join(keys...)
+}
+
+var strictFuncs = template.FuncMap{
+	"index": strictIndex,
+}
+
+// strictIndex is the index builtin, which fails on missing map keys.
+func strictIndex(v any, keys ...any) (any, error) {
 	for _, k := range keys {
-		fmt.Fprintf(&buf, "%s%s=%s\n", prefix, strings.ToUpper(k), fmt.Sprint(envs[k]))
+		rv := reflect.ValueOf(v)
+
+		switch rv.Kind() {
+		case reflect.Map:
+			kv := reflect.ValueOf(k)
+			if !kv.IsValid() || !kv.Type().AssignableTo(rv.Type().Key()) {
+				return nil, fmt.Errorf("cannot index %T with %T", v, k)
+			}
+
+			w := rv.MapIndex(kv)
+			if !w.IsValid() {
+				return nil, fmt.Errorf("map has no entry for key %q", fmt.Sprint(k))
+			}
+
+			v = w.Interface()
+		case reflect.Slice, reflect.Array, reflect.String:
+			i, ok := toInt(k)
+			if !ok {
+				return nil, fmt.Errorf("cannot index %T with %T", v, k)
+			}
+
+			if i < 0 || i >= rv.Len() {
+				return nil, fmt.Errorf("index out of range: %d", i)
+			}
+
+			v = rv.Index(i).Interface()
+		default:
+			return nil, fmt.Errorf("cannot index %T", v)
+		}
 	}
 
-	return bytes.TrimSpace(buf.Bytes()), nil
+	return v, nil
+}
+
+func toInt(v any) (int, bool) {
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint()), true
+	default:
+		return 0, false
+	}
 }
 
-func githubOutput(v any, prefix string) ([]byte, error) {
+// resolveLazy resolves the lazy values in v the template may refer to:
+// all the ones under the keys referenced by name, or every one of them
+// if the template refers to the whole v with a bare dot or $.
+func resolveLazy(t *template.Template, v any) error {
 	m, ok := v.(map[string]any)
-	if !ok {
-		return nil, errors.New("envMarshal: cannot marshal non-object value")
+	if !ok || !lazy.Has(m) {
+		return nil
 	}
 
 	var (
-		outputs = object.Flatten(m, "_")
-		keys    = object.Keys(outputs)
-		buf     bytes.Buffer
+		names = make(map[string]bool)
+		all   bool
 	)
 
-	for _, k := range keys {
-		fmt.Fprintf(&buf, "::set-output name=%s%s::%s\n", prefix, k, fmt.Sprint(outputs[k]))
+	for _, t := range t.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root, func(n parse.Node) {
+				switch n := n.(type) {
+				case *parse.DotNode:
+					all = true
+				case *parse.VariableNode:
+					if len(n.Ident) == 1 && n.Ident[0] == "$" {
+						all = true
+					}
+
+					for _, s := range n.Ident[1:] {
+						names[s] = true
+					}
+				case *parse.FieldNode:
+					for _, s := range n.Ident {
+						names[s] = true
+					}
+				case *parse.ChainNode:
+					for _, s := range n.Field {
+						names[s] = true
+					}
+				}
+			})
+		}
 	}
 
-	return bytes.TrimSpace(buf.Bytes()), nil
+	if all {
+		_, err := lazy.Resolve(m)
+		return err
+	}
+
+	return resolveNames(m, names, nil)
+}
+
+func resolveNames(m map[string]any, names map[string]bool, path []any) error {
+	for k, v := range m {
+		path := append(path[:len(path):len(path)], k)
+
+		if names[k] {
+			x, err := lazy.Resolve(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", keypath.Join(path...), err)
+			}
+
+			m[k] = x
+			continue
+		}
+
+		if v, ok := v.(map[string]any); ok {
+			if err := resolveNames(v, names, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func walk(n parse.Node, fn func(parse.Node)) {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return
+	}
+
+	fn(n)
+
+	switch n := n.(type) {
+	case *parse.ListNode:
+		for _, n := range n.Nodes {
+			walk(n, fn)
+		}
+	case *parse.ActionNode:
+		walk(n.Pipe, fn)
+	case *parse.PipeNode:
+		for _, n := range n.Decl {
+			walk(n, fn)
+		}
+
+		for _, n := range n.Cmds {
+			walk(n, fn)
+		}
+	case *parse.CommandNode:
+		for _, n := range n.Args {
+			walk(n, fn)
+		}
+	case *parse.ChainNode:
+		walk(n.Node, fn)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		walk(n.Pipe, fn)
+	}
+}
+
+func walkBranch(n *parse.BranchNode, fn func(parse.Node)) {
+	walk(n.Pipe, fn)
+	walk(n.List, fn)
+	walk(n.ElseList, fn)
+}
+
+// jqFuncs returns the jq funcs, running the expressions with the ctx,
+// so they stop once the execution times out.
+func jqFuncs(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"jq": func(expr string, v any) any {
+			x, _ := jqRun(ctx, expr, v)
+			return x
+		},
+		"mustJq": func(expr string, v any) (any, error) {
+			return jqRun(ctx, expr, v)
+		},
+	}
+}
+
+// jqRun returns the first output of the expression, or nil if there
+// is none. Expressions producing many outputs are collected with [...].
+func jqRun(ctx context.Context, expr string, v any) (any, error) {
+	out, err := jq.Run(ctx, expr, v)
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
 
+	return out[0], nil
 }
 
 func merge(m, mixin template.FuncMap) template.FuncMap {
@@ -1,34 +1,386 @@
 package template
 
 import (
+	"errors"
+	"io/fs"
+	"regexp"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"text/template"
+
+	"rafal.dev/reflow/pkg/lazy"
 
 	"github.com/google/go-cmp/cmp"
 )
 
-func TestEnvMarshal(t *testing.T) {
+func TestQueryFuncs(t *testing.T) {
+	v := map[string]any{
+		"github": map[string]any{
+			"event": map[string]any{
+				"pull_request": map[string]any{
+					"labels": []any{
+						map[string]any{"name": "bug"},
+						map[string]any{"name": "ci.skip"},
+					},
+				},
+			},
+		},
+	}
+
 	cases := []struct {
-		p string
-		m map[string]any
-		q []byte
+		tmpl string
+		want string
 	}{
 		0: {
-			p: "REFLOW_",
-			m: map[string]any{"GIT": map[string]any{"HEAD": 123, "REF": "bar"}},
-			q: []byte("REFLOW_GIT_HEAD=123\nREFLOW_GIT_REF=bar"),
+			tmpl: `{{ query "$.github.event.pull_request.labels[*].name" . | join "," }}`,
+			want: "bug,ci.skip",
+		},
+		1: {
+			tmpl: `{{ query "$.github.event.pull_request.labels[-1].name" . }}`,
+			want: "ci.skip",
+		},
+		2: {
+			tmpl: `{{ jq "[.github.event.pull_request.labels[].name | select(startswith(\"ci\"))] | first" . }}`,
+			want: "ci.skip",
+		},
+		3: {
+			tmpl: `{{ query "$.github.event.missing" . | default "none" }}`,
+			want: "none",
+		},
+		4: {
+			tmpl: `{{ jq ".github.event.pull_request.labels[].name" . }}`,
+			want: "bug",
+		},
+		5: {
+			tmpl: `{{ jq "[.github.event.pull_request.labels[].name]" . | join "," }}`,
+			want: "bug,ci.skip",
+		},
+		6: {
+			tmpl: `{{ jq "$ENV | length" . }}`,
+			want: "0",
 		},
 	}
 
 	for i, cas := range cases {
 		t.Run("", func(t *testing.T) {
-			q, err := envMarshal(cas.m, cas.p)
+			p, err := Execute(cas.tmpl, v)
 			if err != nil {
-				t.Fatalf("%d: envMarshal()=%+v", i, err)
+				t.Fatalf("%d: Execute()=%+v", i, err)
 			}
 
-			if got, want := string(q), string(cas.q); !cmp.Equal(got, want) {
+			if got, want := string(p), cas.want; !cmp.Equal(got, want) {
 				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(got, want))
 			}
 		})
 	}
+
+	if _, err := Execute(`{{ mustQuery "$.github.missing" . }}`, v); err == nil {
+		t.Fatal("mustQuery: want error")
+	}
+}
+
+func TestExecuteLazy(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	cases := []struct {
+		tmpl  string
+		fail  bool
+		want  string
+		calls map[string]int
+	}{
+		0: {
+			tmpl:  `{{ .values.env }}`,
+			fail:  true,
+			want:  "prod",
+			calls: map[string]int{},
+		},
+		1: {
+			tmpl:  `{{ .reflow.sha }}`,
+			fail:  true,
+			want:  "abc",
+			calls: map[string]int{"sha": 1},
+		},
+		2: {
+			tmpl:  `{{ with .reflow }}{{ .sha }}{{ end }}-{{ $.reflow.sha }}`,
+			want:  "abc-abc",
+			calls: map[string]int{"sha": 1},
+		},
+		3: {
+			tmpl:  `{{ index . "values" "env" }}`,
+			want:  "prod",
+			calls: map[string]int{"sha": 1},
+		},
+		4: {
+			tmpl:  `{{ .values.env }}-{{ .failed }}`,
+			fail:  true,
+			calls: map[string]int{"failed": 1},
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			calls := make(map[string]int)
+
+			thunk := func(name string, v any, err error) *lazy.Value {
+				return lazy.New(func() (any, error) {
+					calls[name]++
+					return v, err
+				})
+			}
+
+			m := map[string]any{
+				"values": map[string]any{"env": "prod"},
+				"reflow": map[string]any{"sha": thunk("sha", "abc", nil)},
+			}
+
+			if cas.fail {
+				m["failed"] = thunk("failed", nil, errBoom)
+			}
+
+			p, err := Execute(cas.tmpl, m)
+			if cas.calls["failed"] != 0 {
+				if !errors.Is(err, errBoom) {
+					t.Fatalf("%d: got %v, want %v", i, err, errBoom)
+				}
+			} else if err != nil {
+				t.Fatalf("%d: Execute()=%+v", i, err)
+			} else if got, want := string(p), cas.want; got != want {
+				t.Fatalf("%d: got %q, want %q", i, got, want)
+			}
+
+			if !cmp.Equal(calls, cas.calls) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(calls, cas.calls))
+			}
+		})
+	}
+}
+
+func TestExecuteStrict(t *testing.T) {
+	v := map[string]any{
+		"values": map[string]any{
+			"env":   "prod",
+			"image": nil,
+			"tags":  []any{"a"},
+		},
+	}
+
+	cases := []struct {
+		tmpl string
+		want string
+		err  string
+	}{
+		0: {
+			tmpl: "env: {{ .values.env }}\ntag: {{ index .values.tags 0 }}",
+			want: "env: prod\ntag: a",
+		},
+		1: {
+			tmpl: "env: {{ .values.env }}\nimage: {{ .values.imgae }}",
+			err:  `values.yaml:2: missing key "values.imgae"`,
+		},
+		2: {
+			tmpl: "{{ .values.image.tag }}",
+			err:  `values.yaml:1: missing key "values.image.tag"`,
+		},
+		3: {
+			tmpl: `{{ index .values "nope" }}`,
+			err:  `values.yaml:1: missing key "values.nope"`,
+		},
+		4: {
+			tmpl: "{{ with .values }}\n\n{{ .nope }}{{ end }}",
+			err:  `values.yaml:3: missing key "nope"`,
+		},
+		5: {
+			tmpl: "{{ $.missing.key }}",
+			err:  `values.yaml:1: missing key "missing"`,
+		},
+		6: {
+			tmpl: "a\n{{ .values.env ",
+			err:  `values.yaml:2: unclosed action`,
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			p, err := Options{Name: "values.yaml", Strict: true}.Execute(cas.tmpl, v)
+			if cas.err != "" {
+				var te *Error
+				if !errors.As(err, &te) {
+					t.Fatalf("%d: got %v, want *Error", i, err)
+				}
+
+				if got := te.Error(); got != cas.err {
+					t.Fatalf("%d: got %q, want %q", i, got, cas.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%d: Execute()=%+v", i, err)
+			}
+
+			if got := string(p); got != cas.want {
+				t.Fatalf("%d: got %q, want %q", i, got, cas.want)
+			}
+		})
+	}
+
+	p, err := Options{}.Execute("{{ .values.imgae }}", v)
+	if err != nil {
+		t.Fatalf("Execute()=%+v", err)
+	}
+
+	if got, want := string(p), "<no value>"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// TestErrorFormats pins the formats of the text/template errors, which
+// locate parses to report the file, line and missing key.
+func TestErrorFormats(t *testing.T) {
+	cases := []struct {
+		text string
+		m    any
+		re   string
+		want []string
+	}{
+		0: {"a\n{{ if }}", nil, "parse", []string{"f.yaml", "2", "missing value for if"}},
+		1: {"a\n\n{{ .x.y }}", map[string]any{"x": map[string]any{}}, "exec", []string{"f.yaml", "3", ".x.y", "map has no entry for key \"y\""}},
+		2: {"{{ index .x \"y\" }}", map[string]any{"x": map[string]any{}}, "exec", []string{"f.yaml", "1", "index .x \"y\"", "error calling index: map has no entry for key \"y\""}},
+		3: {"{{ .x.y.z }}", map[string]any{"x": map[string]any{"y": nil}}, "exec", []string{"f.yaml", "1", ".x.y.z", "nil pointer evaluating interface {}.z"}},
+		4: {"{{ .x }}", struct{}{}, "exec", []string{"f.yaml", "1", ".x", "can't evaluate field x in type struct {}"}},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			tmpl, err := template.New("f.yaml").Option("missingkey=error").Funcs(strictFuncs).Parse(cas.text)
+			if err == nil {
+				err = tmpl.Execute(new(strings.Builder), cas.m)
+			}
+			if err == nil {
+				t.Fatalf("%d: want error", i)
+			}
+
+			re := map[string]*regexp.Regexp{"parse": parseErrorRe, "exec": execErrorRe}[cas.re]
+
+			v := re.FindStringSubmatch(err.Error())
+			if v == nil {
+				t.Fatalf("%d: %s error %q does not match %s", i, cas.re, err, re)
+			}
+
+			if !cmp.Equal(v[1:], cas.want) {
+				t.Fatalf("%d: got != want:\n%s", i, cmp.Diff(v[1:], cas.want))
+			}
+		})
+	}
+
+	keys := map[string]string{
+		`map has no entry for key "y"`:                        "y",
+		`error calling index: map has no entry for key "y"`:   "y",
+		`nil pointer evaluating interface {}.z`:               "z",
+		`nil pointer evaluating map[string]interface {}.name`: "name",
+	}
+
+	for msg, want := range keys {
+		v := missingKeyRe.FindStringSubmatch(msg)
+		if v == nil {
+			t.Fatalf("%q does not match %s", msg, missingKeyRe)
+		}
+
+		if got := v[1] + v[2]; got != want {
+			t.Fatalf("%q: got key %q, want %q", msg, got, want)
+		}
+	}
+}
+
+func TestExecutePartials(t *testing.T) {
+	home := fstest.MapFS{
+		"labels.tpl":   {Data: []byte("app: {{ .name }}\nenv: {{ .env }}")},
+		"_helpers.tpl": {Data: []byte(`{{ define "fullname" }}{{ .name }}-{{ .env }}{{ end }}`)},
+		"k8s/meta.tpl": {Data: []byte("name: {{ template \"fullname\" . }}")},
+		"loop.tpl":     {Data: []byte(`{{ include "loop" . }}`)},
+		"broken.tpl":   {Data: []byte("a: 1\nb: {{ .nope }}")},
+		"chart.tpl":    {Data: []byte("---\ndelims: [\"[[\", \"]]\"]\n---\nname: [[ .name ]]-{{ x }}")},
+		"job.tmpl.tpl": {Data: []byte("run: ${{ github.sha }} {{ .env }}")},
+	}
+
+	run := fstest.MapFS{
+		"_helpers.tpl": {Data: []byte(`{{ define "fullname" }}{{ .name }}-{{ .env }}-run{{ end }}`)},
+	}
+
+	v := map[string]any{
+		"name": "reflow",
+		"env":  "prod",
+		"msg":  "deploying {{ .name }} to {{ .env }}",
+	}
+
+	cases := []struct {
+		tmpl     string
+		partials []fs.FS
+		want     string
+		err      string
+	}{
+		0: {
+			tmpl:     "labels:\n{{ include \"labels\" . | indent 2 }}",
+			partials: []fs.FS{home},
+			want:     "labels:\n  app: reflow\n  env: prod",
+		},
+		1: {
+			tmpl:     `{{ include "k8s/meta" . }}`,
+			partials: []fs.FS{home},
+			want:     "name: reflow-prod",
+		},
+		2: {
+			tmpl:     `{{ include "k8s/meta" . }}`,
+			partials: []fs.FS{home, run},
+			want:     "name: reflow-prod-run",
+		},
+		3: {
+			tmpl: `{{ tpl .msg . | upper }}`,
+			want: "DEPLOYING REFLOW TO PROD",
+		},
+		4: {
+			tmpl:     `{{ include "loop" . }}`,
+			partials: []fs.FS{home},
+			err:      "maximum depth of 100 exceeded",
+		},
+		5: {
+			tmpl:     "x: 1\ny: {{ include \"broken\" . }}",
+			partials: []fs.FS{home},
+			err:      `_partials/broken.tpl:2: missing key "nope"`,
+		},
+		6: {
+			tmpl: `{{ include "missing" . }}`,
+			err:  `no template "missing"`,
+		},
+		7: {
+			tmpl:     `{{ include "chart" . }} {{ include "job.tmpl" . }}`,
+			partials: []fs.FS{home},
+			want:     "name: reflow-{{ x }} run: ${{ github.sha }} prod",
+		},
+	}
+
+	for i, cas := range cases {
+		t.Run("", func(t *testing.T) {
+			o := Options{Name: "values.yaml", Strict: true, Partials: cas.partials}
+
+			p, err := o.Execute(cas.tmpl, v)
+			if cas.err != "" {
+				if err == nil || !strings.Contains(err.Error(), cas.err) {
+					t.Fatalf("%d: got %v, want %q", i, err, cas.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%d: Execute()=%+v", i, err)
+			}
+
+			if got := string(p); got != cas.want {
+				t.Fatalf("%d: got %q, want %q", i, got, cas.want)
+			}
+		})
+	}
 }